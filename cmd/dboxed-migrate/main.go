@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/dboxed/dboxed-common/db/migrator_cli"
+)
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	cli := migrator_cli.New(migrator_cli.Config{
+		DSN:          os.Getenv("DATABASE_DSN"),
+		TemplatesDir: os.Getenv("MIGRATIONS_DIR"),
+	})
+	err := cli.Run(ctx, os.Args[1:])
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,269 @@
+// fetch-docs-assets downloads the self-hosted assets of the docs renderers in huma_utils from the npm registry.
+// It is run via go generate in huma_utils.
+//
+// Each asset directory contains a VERSION file with the pinned npm package version. "latest" (or a missing
+// VERSION file) is resolved to the current release and written back. The tarball is verified against the
+// integrity hash of the registry, and the checksums of the extracted files are written to SHA256SUMS, which
+// huma_utils verifies the embedded files against.
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dboxed/dboxed-common/util"
+)
+
+const registryUrl = "https://registry.npmjs.org"
+
+type assetSource struct {
+	Package string
+	// Files maps paths inside the package to file names in the asset directory
+	Files map[string]string
+	// OptionalFiles are copied if the package contains them, e.g. extracted license comments
+	OptionalFiles map[string]string
+}
+
+var assetSources = map[string]assetSource{
+	"swagger-ui": {
+		Package: "swagger-ui-dist",
+		Files: map[string]string{
+			"swagger-ui-bundle.js":            "swagger-ui-bundle.js",
+			"swagger-ui-standalone-preset.js": "swagger-ui-standalone-preset.js",
+			"swagger-ui.css":                  "swagger-ui.css",
+			"oauth2-redirect.html":            "oauth2-redirect.html",
+			"favicon-16x16.png":               "favicon-16x16.png",
+			"favicon-32x32.png":               "favicon-32x32.png",
+		},
+		OptionalFiles: map[string]string{
+			"oauth2-redirect.js":                          "oauth2-redirect.js",
+			"swagger-ui-bundle.js.LICENSE.txt":            "swagger-ui-bundle.js.LICENSE.txt",
+			"swagger-ui-standalone-preset.js.LICENSE.txt": "swagger-ui-standalone-preset.js.LICENSE.txt",
+			"LICENSE": "LICENSE",
+			"NOTICE":  "NOTICE",
+		},
+	},
+	"redoc": {
+		Package: "redoc",
+		Files: map[string]string{
+			"bundles/redoc.standalone.js": "redoc.standalone.js",
+		},
+		OptionalFiles: map[string]string{
+			"bundles/redoc.standalone.js.LICENSE.txt": "redoc.standalone.js.LICENSE.txt",
+			"LICENSE": "LICENSE",
+		},
+	},
+	"scalar": {
+		Package: "@scalar/api-reference",
+		Files: map[string]string{
+			"dist/browser/standalone.js": "standalone.js",
+		},
+		OptionalFiles: map[string]string{
+			"LICENSE": "LICENSE",
+		},
+	},
+	"elements": {
+		Package: "@stoplight/elements",
+		Files: map[string]string{
+			"web-components.min.js": "web-components.min.js",
+			"styles.min.css":        "styles.min.css",
+		},
+		OptionalFiles: map[string]string{
+			"LICENSE": "LICENSE",
+		},
+	},
+}
+
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+func main() {
+	dir := flag.String("dir", ".", "directory containing the asset directories")
+	flag.Parse()
+
+	names := flag.Args()
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(assetSources))
+	}
+	for _, name := range names {
+		src, ok := assetSources[name]
+		if !ok {
+			_, _ = fmt.Fprintf(os.Stderr, "unknown asset directory %s\n", name)
+			os.Exit(1)
+		}
+		err := fetchAssets(filepath.Join(*dir, name), src)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "fetching %s failed: %s\n", name, err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+type npmVersion struct {
+	Version string `json:"version"`
+	Dist    struct {
+		Tarball   string `json:"tarball"`
+		Integrity string `json:"integrity"`
+	} `json:"dist"`
+}
+
+func fetchAssets(dir string, src assetSource) error {
+	version := "latest"
+	b, err := os.ReadFile(filepath.Join(dir, "VERSION"))
+	if err == nil && strings.TrimSpace(string(b)) != "" {
+		version = strings.TrimSpace(string(b))
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var meta npmVersion
+	err = getJson(fmt.Sprintf("%s/%s/%s", registryUrl, url.PathEscape(src.Package), url.PathEscape(version)), &meta)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("fetching %s@%s\n", src.Package, meta.Version)
+
+	tarball, err := get(meta.Dist.Tarball)
+	if err != nil {
+		return err
+	}
+	err = verifyIntegrity(tarball, meta.Dist.Integrity)
+	if err != nil {
+		return err
+	}
+
+	files, err := extractFiles(tarball, src)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	// drop files of the previous version which are not part of this one
+	oldSums, err := os.ReadFile(filepath.Join(dir, "SHA256SUMS"))
+	if err == nil {
+		for _, l := range strings.Split(string(oldSums), "\n") {
+			fields := strings.Fields(l)
+			if len(fields) == 2 {
+				if _, ok := files[fields[1]]; !ok {
+					_ = os.Remove(filepath.Join(dir, fields[1]))
+				}
+			}
+		}
+	}
+
+	var sums strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		data := files[name]
+		err = util.AtomicWriteFile(filepath.Join(dir, name), data, 0644)
+		if err != nil {
+			return err
+		}
+		h := sha256.Sum256(data)
+		_, _ = fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(h[:]), name)
+	}
+	err = util.AtomicWriteFile(filepath.Join(dir, "SHA256SUMS"), []byte(sums.String()), 0644)
+	if err != nil {
+		return err
+	}
+	return util.AtomicWriteFile(filepath.Join(dir, "VERSION"), []byte(meta.Version+"\n"), 0644)
+}
+
+func extractFiles(tarball []byte, src assetSource) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(tarball))
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		// npm tarballs have all files below a single top level directory, usually "package"
+		_, p, ok := strings.Cut(h.Name, "/")
+		if !ok {
+			continue
+		}
+		dest, ok := src.Files[p]
+		if !ok {
+			dest, ok = src.OptionalFiles[p]
+		}
+		if !ok {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		ret[dest] = data
+	}
+	for p, dest := range src.Files {
+		if _, ok := ret[dest]; !ok {
+			return nil, fmt.Errorf("%s not found in package %s", p, src.Package)
+		}
+	}
+	return ret, nil
+}
+
+// verifyIntegrity checks data against a subresource integrity string as used by npm, e.g. sha512-<base64>
+func verifyIntegrity(data []byte, integrity string) error {
+	for _, x := range strings.Fields(integrity) {
+		algo, expected, ok := strings.Cut(x, "-")
+		if !ok || algo != "sha512" {
+			continue
+		}
+		h := sha512.Sum512(data)
+		if base64.StdEncoding.EncodeToString(h[:]) != expected {
+			return fmt.Errorf("tarball integrity mismatch")
+		}
+		return nil
+	}
+	return fmt.Errorf("no sha512 integrity hash in %q", integrity)
+}
+
+func get(u string) ([]byte, error) {
+	resp, err := httpClient.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s failed: %s", u, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func getJson(u string, v any) error {
+	b, err := get(u)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
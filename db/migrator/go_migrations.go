@@ -0,0 +1,43 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/dboxed/dboxed-common/db/querier"
+	"github.com/jmoiron/sqlx"
+	"github.com/pressly/goose/v3"
+)
+
+type GoMigrationFunc func(q *querier.Querier) error
+
+// GoMigration is a migration implemented in Go. Its version shares the version space with the SQL
+// migrations of the same dialect, so it's ordered between them.
+type GoMigration struct {
+	Version int64
+	// Name is used to build the source name (<version>_<name>.go) which is shown in status output
+	Name string
+
+	Up   GoMigrationFunc
+	Down GoMigrationFunc
+}
+
+func (m *GoMigration) build(db *sqlx.DB) *goose.Migration {
+	wrap := func(fn GoMigrationFunc) *goose.GoFunc {
+		if fn == nil {
+			return nil
+		}
+		return &goose.GoFunc{
+			RunTx: func(ctx context.Context, tx *sql.Tx) error {
+				return fn(querier.NewQuerierFromSqlTx(ctx, db, tx))
+			},
+		}
+	}
+
+	gm := goose.NewGoMigration(m.Version, wrap(m.Up), wrap(m.Down))
+	if m.Name != "" {
+		gm.Source = fmt.Sprintf("%d_%s.go", m.Version, m.Name)
+	}
+	return gm
+}
@@ -0,0 +1,322 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pressly/goose/v3"
+)
+
+type MigrationState string
+
+const (
+	StateApplied MigrationState = "applied"
+	StatePending MigrationState = "pending"
+)
+
+type MigrationStatus struct {
+	Version   int64          `json:"version"`
+	Source    string         `json:"source"`
+	Type      string         `json:"type"`
+	State     MigrationState `json:"state"`
+	AppliedAt *time.Time     `json:"applied_at,omitempty"`
+}
+
+type MigrationResult struct {
+	Version   int64         `json:"version"`
+	Source    string        `json:"source"`
+	Type      string        `json:"type"`
+	Direction string        `json:"direction"`
+	Duration  time.Duration `json:"duration"`
+	Empty     bool          `json:"empty"`
+	DryRun    bool          `json:"dry_run"`
+
+	// Statements is only set in dry-run mode and contains the SQL statements that would be executed
+	Statements []string `json:"statements,omitempty"`
+}
+
+func Status(ctx context.Context, db *sqlx.DB, migrations map[string]fs.FS) ([]MigrationStatus, error) {
+	m, err := New(db, migrations, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return m.Status(ctx)
+}
+
+func UpTo(ctx context.Context, db *sqlx.DB, migrations map[string]fs.FS, version int64, dryRun bool) ([]MigrationResult, error) {
+	m, err := New(db, migrations, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return m.UpTo(ctx, version, dryRun)
+}
+
+func DownTo(ctx context.Context, db *sqlx.DB, migrations map[string]fs.FS, version int64, dryRun bool) ([]MigrationResult, error) {
+	m, err := New(db, migrations, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return m.DownTo(ctx, version, dryRun)
+}
+
+func Redo(ctx context.Context, db *sqlx.DB, migrations map[string]fs.FS, dryRun bool) ([]MigrationResult, error) {
+	m, err := New(db, migrations, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return m.Redo(ctx, dryRun)
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	status, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]MigrationStatus, 0, len(status))
+	for _, s := range status {
+		ms := MigrationStatus{
+			Version: s.Source.Version,
+			Source:  s.Source.Path,
+			Type:    string(s.Source.Type),
+			State:   MigrationState(s.State),
+		}
+		if s.State == goose.StateApplied {
+			ms.AppliedAt = &s.AppliedAt
+		}
+		ret = append(ret, ms)
+	}
+	return ret, nil
+}
+
+// UpTo applies all pending migrations up to and including version
+func (m *Migrator) UpTo(ctx context.Context, version int64, dryRun bool) ([]MigrationResult, error) {
+	if dryRun {
+		return m.planUpTo(ctx, version)
+	}
+	var res []*goose.MigrationResult
+	err := m.withLock(ctx, func() error {
+		var err error
+		res, err = m.provider.UpTo(ctx, version)
+		return err
+	})
+	return convertResults(res), err
+}
+
+// DownTo rolls back all migrations down to, but not including, version
+func (m *Migrator) DownTo(ctx context.Context, version int64, dryRun bool) ([]MigrationResult, error) {
+	if dryRun {
+		return m.planDownTo(ctx, version)
+	}
+	var res []*goose.MigrationResult
+	err := m.withLock(ctx, func() error {
+		var err error
+		res, err = m.provider.DownTo(ctx, version)
+		return err
+	})
+	return convertResults(res), err
+}
+
+// Down rolls back the most recently applied migration
+func (m *Migrator) Down(ctx context.Context, dryRun bool) ([]MigrationResult, error) {
+	if dryRun {
+		status, err := m.Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		last := lastApplied(status)
+		if last == nil {
+			return nil, goose.ErrNoNextVersion
+		}
+		down, err := m.planResult(*last, "down")
+		if err != nil {
+			return nil, err
+		}
+		return []MigrationResult{down}, nil
+	}
+
+	var res []*goose.MigrationResult
+	err := m.withLock(ctx, func() error {
+		down, err := m.provider.Down(ctx)
+		if err != nil {
+			return err
+		}
+		res = append(res, down)
+		return nil
+	})
+	return convertResults(res), err
+}
+
+// Redo rolls back the most recently applied migration and applies it again
+func (m *Migrator) Redo(ctx context.Context, dryRun bool) ([]MigrationResult, error) {
+	if dryRun {
+		status, err := m.Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		last := lastApplied(status)
+		if last == nil {
+			return nil, goose.ErrNoNextVersion
+		}
+		down, err := m.planResult(*last, "down")
+		if err != nil {
+			return nil, err
+		}
+		up, err := m.planResult(*last, "up")
+		if err != nil {
+			return nil, err
+		}
+		return []MigrationResult{down, up}, nil
+	}
+
+	var res []*goose.MigrationResult
+	err := m.withLock(ctx, func() error {
+		down, err := m.provider.Down(ctx)
+		if err != nil {
+			return err
+		}
+		res = append(res, down)
+		up, err := m.provider.ApplyVersion(ctx, down.Source.Version, true)
+		if err != nil {
+			return err
+		}
+		res = append(res, up)
+		return nil
+	})
+	return convertResults(res), err
+}
+
+func convertResults(res []*goose.MigrationResult) []MigrationResult {
+	ret := make([]MigrationResult, 0, len(res))
+	for _, r := range res {
+		if r == nil {
+			continue
+		}
+		ret = append(ret, MigrationResult{
+			Version:   r.Source.Version,
+			Source:    r.Source.Path,
+			Type:      string(r.Source.Type),
+			Direction: r.Direction,
+			Duration:  r.Duration,
+			Empty:     r.Empty,
+		})
+	}
+	return ret
+}
+
+func lastApplied(status []MigrationStatus) *MigrationStatus {
+	var ret *MigrationStatus
+	for i, s := range status {
+		if s.State != StateApplied {
+			continue
+		}
+		if ret == nil || s.AppliedAt.After(*ret.AppliedAt) || (s.AppliedAt.Equal(*ret.AppliedAt) && s.Version > ret.Version) {
+			ret = &status[i]
+		}
+	}
+	return ret
+}
+
+func (m *Migrator) planUpTo(ctx context.Context, version int64) ([]MigrationResult, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dbVersion, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// goose's UpTo checks for missing migrations regardless of the target version
+	var missing []int64
+	for _, s := range status {
+		if s.State == StatePending && s.Version < dbVersion {
+			missing = append(missing, s.Version)
+		}
+	}
+	if len(missing) != 0 && !m.opts.AllowMissing {
+		return nil, newMissingMigrationsError(missing, dbVersion)
+	}
+
+	var ret []MigrationResult
+	for _, s := range status {
+		if s.State != StatePending || s.Version > version {
+			continue
+		}
+		r, err := m.planResult(s, "up")
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+// newMissingMigrationsError returns the same error as goose for missing (out-of-order) migrations
+func newMissingMigrationsError(missing []int64, dbVersion int64) error {
+	versions := make([]string, 0, len(missing))
+	for _, v := range missing {
+		versions = append(versions, strconv.FormatInt(v, 10))
+	}
+	msg := "migration"
+	versionsMsg := "version " + versions[0]
+	if len(versions) > 1 {
+		msg += "s"
+		versionsMsg = "versions " + strings.Join(versions, ",")
+	}
+	return fmt.Errorf("detected %d missing (out-of-order) %s lower than database version (%d): %s",
+		len(missing), msg, dbVersion, versionsMsg)
+}
+
+func (m *Migrator) planDownTo(ctx context.Context, version int64) ([]MigrationResult, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ret []MigrationResult
+	for _, s := range slices.Backward(status) {
+		if s.State != StateApplied || s.Version <= version {
+			continue
+		}
+		r, err := m.planResult(s, "down")
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+func (m *Migrator) planResult(s MigrationStatus, direction string) (MigrationResult, error) {
+	r := MigrationResult{
+		Version:   s.Version,
+		Source:    s.Source,
+		Type:      s.Type,
+		Direction: direction,
+		DryRun:    true,
+	}
+	if s.Type != string(goose.TypeSQL) {
+		return r, nil
+	}
+
+	b, err := fs.ReadFile(m.fsys, s.Source)
+	if err != nil {
+		return r, err
+	}
+	sm, err := parseSqlMigration(string(b))
+	if err != nil {
+		return r, fmt.Errorf("failed to parse %s: %w", s.Source, err)
+	}
+	if direction == "up" {
+		r.Statements = sm.Up
+	} else {
+		r.Statements = sm.Down
+	}
+	r.Empty = len(r.Statements) == 0
+	return r, nil
+}
@@ -0,0 +1,224 @@
+package migrator
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+const (
+	LintRuleDialect             = "dialect"
+	LintRuleDropTable           = "drop-table"
+	LintRuleDropColumn          = "drop-column"
+	LintRuleAlterColumnType     = "alter-column-type"
+	LintRuleTruncate            = "truncate"
+	LintRuleNonConcurrentIndex  = "non-concurrent-index"
+	LintRuleConcurrentIndexInTx = "concurrent-index-in-transaction"
+)
+
+type LintIssue struct {
+	Driver    string       `json:"driver"`
+	File      string       `json:"file"`
+	Direction string       `json:"direction"`
+	Statement int          `json:"statement"`
+	Rule      string       `json:"rule"`
+	Severity  LintSeverity `json:"severity"`
+	Message   string       `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s %s (%s statement %d): [%s] %s", i.Severity, i.Driver, i.File, i.Direction, i.Statement+1, i.Rule, i.Message)
+}
+
+type dialectConstruct struct {
+	re   *regexp.Regexp
+	desc string
+}
+
+func construct(re string, desc string) dialectConstruct {
+	return dialectConstruct{re: regexp.MustCompile(re), desc: desc}
+}
+
+// unsupportedConstructs lists constructs per driver that the driver does not support
+var unsupportedConstructs = map[string][]dialectConstruct{
+	"sqlite3": {
+		construct(`::\s*[a-z_]`, "postgres-style :: casts"),
+		construct(`\bjsonb\b`, "jsonb type"),
+		construct(`\b(big)?serial\b`, "serial types"),
+		construct(`\btimestamptz\b`, "timestamptz type"),
+		construct(`\bbytea\b`, "bytea type"),
+		construct(`\balter\s+table\s+\S+\s+alter\s+column\b`, "alter column"),
+		construct(`\balter\s+table\s+\S+\s+(add|drop)\s+constraint\b`, "adding/dropping constraints"),
+		construct(`\bconcurrently\b`, "concurrent index operations"),
+		construct(`\bcreate\s+extension\b`, "extensions"),
+		construct(`\bcreate\s+type\b`, "custom types"),
+		construct(`\bcomment\s+on\b`, "comment on"),
+		construct(`\bilike\b`, "ilike"),
+		construct(`\bnow\s*\(`, "now()"),
+		construct(`\bgen_random_uuid\s*\(`, "gen_random_uuid()"),
+		construct(`\busing\s+(gin|gist|brin|hash)\b`, "index methods"),
+		construct(`\$\$`, "dollar quoting"),
+	},
+	"pgx": {
+		construct(`\bautoincrement\b`, "autoincrement"),
+		construct(`\bpragma\b`, "pragma"),
+		construct(`\bwithout\s+rowid\b`, "without rowid"),
+		construct(`\bdatetime\b`, "datetime type/function"),
+		construct(`\bstrftime\s*\(`, "strftime()"),
+		construct(`\binsert\s+or\s+(replace|ignore|abort|fail|rollback)\b`, "insert or ..."),
+		construct(`\bblob\b`, "blob type"),
+		construct(`\bjson_(extract|patch|set|remove|each|group_array)\s*\(`, "sqlite json functions"),
+		construct(`\bglob\b`, "glob"),
+	},
+}
+
+var (
+	reDropTable       = regexp.MustCompile(`^drop\s+table\b`)
+	reDropColumn      = regexp.MustCompile(`^alter\s+table\s+.*\bdrop\s+(column\s+)?(if\s+exists\s+)?("?[a-z_0-9]+"?)\s*(,|;|$|cascade|restrict)`)
+	reDropConstraint  = regexp.MustCompile(`^alter\s+table\s+.*\bdrop\s+constraint\b`)
+	reAlterColumnType = regexp.MustCompile(`^alter\s+table\s+.*\balter\s+(column\s+)?\S+\s+(set\s+data\s+)?type\b`)
+	reTruncate        = regexp.MustCompile(`^truncate\b`)
+	reCreateIndex     = regexp.MustCompile(`^create\s+(unique\s+)?index\s+(concurrently\s+)?(if\s+not\s+exists\s+)?(\S+\s+)?on\s+(only\s+)?("?[a-z_0-9.]+"?)`)
+	reCreateTable     = regexp.MustCompile(`^create\s+(temp\s+|temporary\s+)?table\s+(if\s+not\s+exists\s+)?("?[a-z_0-9.]+"?)`)
+	reLintAllow       = regexp.MustCompile(`^--\s*lint:allow\s+(.*)$`)
+	reStringLiteral   = regexp.MustCompile(`'(?:[^']|'')*'`)
+	reLineComment     = regexp.MustCompile(`--[^\n]*`)
+	reWhitespace      = regexp.MustCompile(`\s+`)
+)
+
+// normalizeStatement lowercases the statement and strips comments and string literal contents, so that
+// rules don't match inside them
+func normalizeStatement(s string) string {
+	s = reStringLiteral.ReplaceAllString(s, "''")
+	s = reLineComment.ReplaceAllString(s, "")
+	s = reWhitespace.ReplaceAllString(s, " ")
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+func parseLintAllow(header string) []string {
+	var ret []string
+	for _, line := range strings.Split(header, "\n") {
+		m := reLintAllow.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		for _, r := range strings.FieldsFunc(m[1], func(r rune) bool { return r == ',' || r == ' ' }) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// Lint checks the migrations (keyed by driver name) for dialect portability issues and for destructive or
+// potentially blocking operations. Destructive operations are errors unless they are acknowledged with a
+// "-- lint:allow <rule>[, <rule>...]" line in the header of the migration file, before the first goose
+// annotation. Blocking operations are warnings, which can be acknowledged the same way.
+func Lint(migrations map[string]fs.FS) ([]LintIssue, error) {
+	var issues []LintIssue
+	for _, driver := range slices.Sorted(maps.Keys(migrations)) {
+		fsys := migrations[driver]
+		files, err := fs.ReadDir(fsys, ".")
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if !strings.HasSuffix(f.Name(), ".sql") {
+				continue
+			}
+			b, err := fs.ReadFile(fsys, f.Name())
+			if err != nil {
+				return nil, err
+			}
+			m, err := parseSqlMigration(string(b))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", f.Name(), err)
+			}
+			issues = append(issues, lintMigration(driver, f.Name(), m)...)
+		}
+	}
+	return issues, nil
+}
+
+func lintMigration(driver string, file string, m *sqlMigration) []LintIssue {
+	allowed := parseLintAllow(m.Header)
+
+	var issues []LintIssue
+	add := func(direction string, idx int, rule string, severity LintSeverity, msg string, args ...any) {
+		// dialect issues and concurrent indexes in transactions break the migration, they can't be allowed
+		if rule != LintRuleDialect && rule != LintRuleConcurrentIndexInTx && slices.Contains(allowed, rule) {
+			return
+		}
+		issues = append(issues, LintIssue{
+			Driver:    driver,
+			File:      file,
+			Direction: direction,
+			Statement: idx,
+			Rule:      rule,
+			Severity:  severity,
+			Message:   fmt.Sprintf(msg, args...),
+		})
+	}
+
+	createdTables := map[string]bool{}
+	for _, x := range []struct {
+		direction  string
+		statements []string
+	}{{"up", m.Up}, {"down", m.Down}} {
+		for i, stmt := range x.statements {
+			s := normalizeStatement(stmt)
+
+			for _, c := range unsupportedConstructs[driver] {
+				if c.re.MatchString(s) {
+					add(x.direction, i, LintRuleDialect, LintError, "%s not supported by %s", c.desc, driver)
+				}
+			}
+
+			if driver == "pgx" && strings.Contains(s, " concurrently ") && !m.NoTx {
+				add(x.direction, i, LintRuleConcurrentIndexInTx, LintError,
+					"concurrent index operations require the '-- +goose NO TRANSACTION' annotation")
+			}
+
+			if cm := reCreateTable.FindStringSubmatch(s); cm != nil {
+				createdTables[strings.Trim(cm[3], `"`)] = true
+			}
+
+			// destructive operations are expected in down migrations
+			if x.direction != "up" {
+				continue
+			}
+
+			switch {
+			case reDropTable.MatchString(s):
+				add(x.direction, i, LintRuleDropTable, LintError, "drops a table")
+			case reDropConstraint.MatchString(s):
+			case reDropColumn.MatchString(s):
+				add(x.direction, i, LintRuleDropColumn, LintError, "drops a column")
+			case reAlterColumnType.MatchString(s):
+				add(x.direction, i, LintRuleAlterColumnType, LintError, "changes the type of a column, which might narrow it")
+			case reTruncate.MatchString(s):
+				add(x.direction, i, LintRuleTruncate, LintError, "truncates a table")
+			}
+
+			if driver == "pgx" {
+				if cm := reCreateIndex.FindStringSubmatch(s); cm != nil && cm[2] == "" {
+					table := strings.Trim(cm[6], `"`)
+					if !createdTables[table] {
+						add(x.direction, i, LintRuleNonConcurrentIndex, LintWarning,
+							"creates an index on existing table %s without concurrently, which blocks writes", table)
+					}
+				}
+			}
+		}
+	}
+	return issues
+}
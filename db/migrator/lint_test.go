@@ -0,0 +1,99 @@
+package migrator
+
+import (
+	"testing"
+)
+
+func lintTestMigration(t *testing.T, driver string, sql string) []LintIssue {
+	t.Helper()
+	m, err := parseSqlMigration(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lintMigration(driver, "00001_test.sql", m)
+}
+
+func TestLintRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		driver   string
+		header   string
+		up       string
+		severity LintSeverity
+		// allowable is false for rules which can't be acknowledged with lint:allow
+		allowable bool
+	}{
+		{LintRuleDialect, "sqlite3", "", "create table a (data jsonb);", LintError, false},
+		{LintRuleDialect, "pgx", "", "create table a (id integer primary key autoincrement);", LintError, false},
+		{LintRuleDropTable, "pgx", "", "drop table a;", LintError, true},
+		{LintRuleDropColumn, "pgx", "", "alter table a drop column b;", LintError, true},
+		{LintRuleDropColumn, "sqlite3", "", "alter table a drop b;", LintError, true},
+		{LintRuleAlterColumnType, "pgx", "", "alter table a alter column b type bigint;", LintError, true},
+		{LintRuleTruncate, "pgx", "", "truncate a;", LintError, true},
+		{LintRuleNonConcurrentIndex, "pgx", "", "create index a_b on a (b);", LintWarning, true},
+		{LintRuleConcurrentIndexInTx, "pgx", "", "create index concurrently a_b on a (b);", LintError, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.driver+"/"+tc.rule, func(t *testing.T) {
+			sql := "-- +goose Up\n" + tc.up + "\n"
+
+			issues := lintTestMigration(t, tc.driver, sql)
+			if len(issues) != 1 || issues[0].Rule != tc.rule || issues[0].Severity != tc.severity {
+				t.Fatalf("expected a single %s %s issue, got %v", tc.severity, tc.rule, issues)
+			}
+
+			issues = lintTestMigration(t, tc.driver, "-- lint:allow "+tc.rule+"\n"+sql)
+			if tc.allowable && len(issues) != 0 {
+				t.Fatalf("expected no issues with lint:allow, got %v", issues)
+			}
+			if !tc.allowable && (len(issues) != 1 || issues[0].Rule != tc.rule) {
+				t.Fatalf("expected lint:allow to be ignored for %s, got %v", tc.rule, issues)
+			}
+		})
+	}
+}
+
+func TestLintAllowMultipleRules(t *testing.T) {
+	issues := lintTestMigration(t, "pgx", `-- lint:allow drop-table, truncate
+-- +goose Up
+truncate a;
+drop table a;
+alter table b drop column c;
+`)
+	if len(issues) != 1 || issues[0].Rule != LintRuleDropColumn || issues[0].Statement != 2 {
+		t.Fatalf("expected only the drop-column issue, got %v", issues)
+	}
+}
+
+func TestLintIgnoredStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		sql    string
+	}{
+		{"destructive down migration", "pgx", `-- +goose Up
+create table a (id bigint);
+-- +goose Down
+drop table a;
+`},
+		{"index on a new table", "pgx", `-- +goose Up
+create table a (id bigint, b text);
+create index a_b on a (b);
+`},
+		{"concurrent index without transaction", "pgx", `-- +goose NO TRANSACTION
+-- +goose Up
+create index concurrently a_b on a (b);
+`},
+		{"rule keywords in strings and comments", "sqlite3", `-- +goose Up
+insert into a (x) values ('drop table b; jsonb'); -- truncate c
+`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			issues := lintTestMigration(t, tc.driver, tc.sql)
+			if len(issues) != 0 {
+				t.Fatalf("expected no issues, got %v", issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/dboxed/dboxed-common/util"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type LockOptions struct {
+	// Disabled disables locking completely
+	Disabled bool
+	// Timeout is the maximum time to wait for the lock
+	Timeout time.Duration
+	// PollInterval is the interval in which the lock is retried and the current holder is logged
+	PollInterval time.Duration
+
+	// PostgresLockId is the key passed to pg_advisory_lock
+	PostgresLockId int64
+
+	// SqliteLockTable is the name of the table used for locking on SQLite
+	SqliteLockTable string
+	// SqliteStaleAfter is the time after which a SQLite lock is considered stale (e.g. because the holder
+	// crashed) and is taken over. The holder refreshes the lock every SqliteStaleAfter / 3.
+	SqliteStaleAfter time.Duration
+}
+
+// withDefaults fills all zero fields from DefaultLockOptions
+func (o LockOptions) withDefaults() LockOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultLockOptions.Timeout
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = DefaultLockOptions.PollInterval
+	}
+	if o.PostgresLockId == 0 {
+		o.PostgresLockId = DefaultLockOptions.PostgresLockId
+	}
+	if o.SqliteLockTable == "" {
+		o.SqliteLockTable = DefaultLockOptions.SqliteLockTable
+	}
+	if o.SqliteStaleAfter <= 0 {
+		o.SqliteStaleAfter = DefaultLockOptions.SqliteStaleAfter
+	}
+	return o
+}
+
+var DefaultLockOptions = LockOptions{
+	Timeout:          5 * time.Minute,
+	PollInterval:     2 * time.Second,
+	PostgresLockId:   0x646278_6d6967, // "dbxmig"
+	SqliteLockTable:  "goose_migration_lock",
+	SqliteStaleAfter: 15 * time.Minute,
+}
+
+var ErrLockTimeout = errors.New("timed out waiting for migration lock")
+
+type migrationLock struct {
+	db     *sqlx.DB
+	conn   *sql.Conn
+	opts   LockOptions
+	log    *slog.Logger
+	holder string
+
+	stopHeartbeat chan struct{}
+	heartbeatDone chan struct{}
+}
+
+func lockHolderName() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), uuid.NewString())
+}
+
+// withLock runs fn while holding the cross-process migration lock. The lock is released when fn returns,
+// even if ctx got cancelled in the meantime.
+func withLock(ctx context.Context, db *sqlx.DB, opts LockOptions, log *slog.Logger, fn func() error) error {
+	if opts.Disabled {
+		return fn()
+	}
+
+	l, err := acquireLock(ctx, db, opts, log)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := l.release(context.WithoutCancel(ctx))
+		if err != nil {
+			log.ErrorContext(ctx, "failed to release migration lock", slog.Any("error", err))
+		}
+	}()
+
+	return fn()
+}
+
+func acquireLock(ctx context.Context, db *sqlx.DB, opts LockOptions, log *slog.Logger) (*migrationLock, error) {
+	opts = opts.withDefaults()
+	l := &migrationLock{
+		db:     db,
+		opts:   opts,
+		log:    log,
+		holder: lockHolderName(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var err error
+	switch db.DriverName() {
+	case "pgx", "postgres":
+		l.conn, err = db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+	case "sqlite3", "sqlite":
+		_, err = db.ExecContext(ctx, fmt.Sprintf(`create table if not exists "%s" (
+    id        integer primary key check (id = 1),
+    holder    text not null,
+    locked_at datetime not null
+)`, opts.SqliteLockTable))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported database driver %s", db.DriverName())
+	}
+
+	for {
+		ok, err := l.tryLock(ctx)
+		if err != nil {
+			l.closeConn()
+			return nil, err
+		}
+		if ok {
+			l.log.InfoContext(ctx, "acquired migration lock", slog.Any("holder", l.holder))
+			if l.conn == nil {
+				l.startHeartbeat()
+			}
+			return l, nil
+		}
+
+		holder, err := l.getHolder(ctx)
+		if err != nil {
+			l.log.WarnContext(ctx, "failed to determine migration lock holder", slog.Any("error", err))
+		} else {
+			l.log.InfoContext(ctx, "waiting for migration lock", slog.Any("holder", holder))
+		}
+
+		if !util.SleepWithContext(ctx, opts.PollInterval) {
+			l.closeConn()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrLockTimeout
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *migrationLock) tryLock(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		var ok bool
+		err := l.conn.QueryRowContext(ctx, "select pg_try_advisory_lock($1)", l.opts.PostgresLockId).Scan(&ok)
+		if err != nil {
+			return false, err
+		}
+		return ok, nil
+	}
+
+	_, err := l.db.ExecContext(ctx, fmt.Sprintf(`delete from "%s" where locked_at < ?`, l.opts.SqliteLockTable),
+		time.Now().UTC().Add(-l.opts.SqliteStaleAfter))
+	if err != nil {
+		return false, err
+	}
+	r, err := l.db.ExecContext(ctx, fmt.Sprintf(`insert into "%s" (id, holder, locked_at) values (1, ?, ?) on conflict do nothing`, l.opts.SqliteLockTable),
+		l.holder, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	ra, err := r.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return ra == 1, nil
+}
+
+// startHeartbeat keeps refreshing locked_at of the SQLite lock, so that long-running migrations are not
+// considered stale by other processes
+func (l *migrationLock) startHeartbeat() {
+	l.stopHeartbeat = make(chan struct{})
+	l.heartbeatDone = make(chan struct{})
+	interval := l.opts.SqliteStaleAfter / 3
+
+	go func() {
+		defer close(l.heartbeatDone)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-l.stopHeartbeat:
+				return
+			case <-t.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			r, err := l.db.ExecContext(ctx, fmt.Sprintf(`update "%s" set locked_at = ? where id = 1 and holder = ?`, l.opts.SqliteLockTable),
+				time.Now().UTC(), l.holder)
+			cancel()
+			if err != nil {
+				l.log.Warn("failed to refresh migration lock", slog.Any("error", err))
+				continue
+			}
+			ra, err := r.RowsAffected()
+			if err == nil && ra == 0 {
+				l.log.Error("lost migration lock", slog.Any("holder", l.holder))
+			}
+		}
+	}()
+}
+
+func (l *migrationLock) getHolder(ctx context.Context) (string, error) {
+	var holder string
+	if l.conn != nil {
+		err := l.conn.QueryRowContext(ctx, `select format('pid=%s application=%s client=%s since=%s', a.pid, a.application_name, a.client_addr, a.backend_start)
+from pg_locks l
+join pg_stat_activity a on a.pid = l.pid
+where l.locktype = 'advisory' and l.granted and ((l.classid::bigint << 32) | l.objid::bigint) = $1
+limit 1`, l.opts.PostgresLockId).Scan(&holder)
+		if err != nil {
+			return "", err
+		}
+		return holder, nil
+	}
+
+	err := l.db.GetContext(ctx, &holder, fmt.Sprintf(`select holder || ' since ' || locked_at from "%s" where id = 1`, l.opts.SqliteLockTable))
+	if err != nil {
+		return "", err
+	}
+	return holder, nil
+}
+
+func (l *migrationLock) release(ctx context.Context) error {
+	if l.conn != nil {
+		defer l.closeConn()
+		_, err := l.conn.ExecContext(ctx, "select pg_advisory_unlock($1)", l.opts.PostgresLockId)
+		return err
+	}
+
+	if l.stopHeartbeat != nil {
+		close(l.stopHeartbeat)
+		<-l.heartbeatDone
+		l.stopHeartbeat = nil
+	}
+	_, err := l.db.ExecContext(ctx, fmt.Sprintf(`delete from "%s" where id = 1 and holder = ?`, l.opts.SqliteLockTable), l.holder)
+	return err
+}
+
+func (l *migrationLock) closeConn() {
+	if l.conn != nil {
+		_ = l.conn.Close()
+		l.conn = nil
+	}
+}
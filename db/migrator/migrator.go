@@ -4,26 +4,167 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"log/slog"
 
+	"github.com/dboxed/dboxed-common/db/schematemplates"
 	"github.com/jmoiron/sqlx"
 	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
 )
 
-func Migrate(ctx context.Context, db *sqlx.DB, migrations map[string]fs.FS) error {
-	fs, ok := migrations[db.DriverName()]
+type Options struct {
+	// VersionTable is the name of the goose version table. Defaults to goose_db_version.
+	VersionTable string
+	// Logger receives goose's progress output. If nil, goose runs silently and locking is logged to slog.Default().
+	Logger *slog.Logger
+	// Lock configures the cross-process migration lock. Defaults to DefaultLockOptions.
+	Lock *LockOptions
+
+	// GoMigrations are Go migrations per driver name, registered alongside the SQL migrations
+	GoMigrations map[string][]GoMigration
+
+	// GeneratedMigrations are previously generated migrations per driver name. NewFromTemplates fails if they
+	// differ from the rendered templates.
+	GeneratedMigrations map[string]fs.FS
+
+	// AllowMissing applies missing (out-of-order) migrations, which are lower than the current database
+	// version, instead of failing. See goose.WithAllowOutofOrder.
+	AllowMissing bool
+}
+
+// Migrator runs migrations against a single database. It does not touch goose's global state, so
+// multiple migrators (e.g. for different databases) can be used concurrently.
+type Migrator struct {
+	db       *sqlx.DB
+	fsys     fs.FS
+	opts     Options
+	provider *goose.Provider
+}
+
+func New(db *sqlx.DB, migrations map[string]fs.FS, opts Options) (*Migrator, error) {
+	fsys, ok := migrations[db.DriverName()]
 	if !ok {
-		return fmt.Errorf("migrations for %s not found", db.DriverName())
+		return nil, fmt.Errorf("migrations for %s not found", db.DriverName())
+	}
+	dialect, err := getDialect(db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.VersionTable == "" {
+		opts.VersionTable = goose.DefaultTablename
+	}
+	if opts.Lock == nil {
+		opts.Lock = &DefaultLockOptions
+	}
+
+	store, err := database.NewStore(dialect, opts.VersionTable)
+	if err != nil {
+		return nil, err
+	}
+	providerOpts := []goose.ProviderOption{
+		goose.WithStore(store),
+		goose.WithDisableGlobalRegistry(true),
+		goose.WithAllowOutofOrder(opts.AllowMissing),
+	}
+	for _, gm := range opts.GoMigrations[db.DriverName()] {
+		providerOpts = append(providerOpts, goose.WithGoMigrations(gm.build(db)))
+	}
+	if opts.Logger != nil {
+		providerOpts = append(providerOpts,
+			goose.WithVerbose(true),
+			goose.WithLogger(&gooseLogger{logger: opts.Logger}),
+		)
+	}
+
+	p, err := goose.NewProvider(goose.DialectCustom, db.DB, fsys, providerOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:       db,
+		fsys:     fsys,
+		opts:     opts,
+		provider: p,
+	}, nil
+}
+
+// NewFromTemplates renders the schema templates in memory and creates a Migrator for them
+func NewFromTemplates(db *sqlx.DB, templates fs.FS, opts Options) (*Migrator, error) {
+	dbType, err := schematemplates.DbTypeForDriver(db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := schematemplates.RenderSchemasFS(templates, dbType)
+	if err != nil {
+		return nil, err
+	}
+	if generated, ok := opts.GeneratedMigrations[db.DriverName()]; ok {
+		err = schematemplates.CheckDrift(rendered, generated)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return New(db, map[string]fs.FS{db.DriverName(): rendered}, opts)
+}
 
-	goose.SetBaseFS(fs)
-	err := goose.SetDialect(db.DriverName())
+func Migrate(ctx context.Context, db *sqlx.DB, migrations map[string]fs.FS) error {
+	m, err := New(db, migrations, Options{})
 	if err != nil {
 		return err
 	}
+	_, err = m.Up(ctx)
+	return err
+}
 
-	err = goose.UpContext(ctx, db.DB, ".")
+func MigrateTemplates(ctx context.Context, db *sqlx.DB, templates fs.FS) error {
+	m, err := NewFromTemplates(db, templates, Options{})
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = m.Up(ctx)
+	return err
+}
+
+// Up applies all pending migrations
+func (m *Migrator) Up(ctx context.Context) ([]MigrationResult, error) {
+	var res []*goose.MigrationResult
+	err := m.withLock(ctx, func() error {
+		var err error
+		res, err = m.provider.Up(ctx)
+		return err
+	})
+	return convertResults(res), err
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	log := m.opts.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	return withLock(ctx, m.db, *m.opts.Lock, log, fn)
+}
+
+func getDialect(driverName string) (goose.Dialect, error) {
+	switch driverName {
+	case "pgx", "postgres":
+		return goose.DialectPostgres, nil
+	case "sqlite3", "sqlite":
+		return goose.DialectSQLite3, nil
+	default:
+		return "", fmt.Errorf("unsupported database driver %s", driverName)
+	}
+}
+
+type gooseLogger struct {
+	logger *slog.Logger
+}
+
+func (l *gooseLogger) Printf(format string, v ...any) {
+	l.logger.Info(fmt.Sprintf(format, v...))
+}
+
+func (l *gooseLogger) Fatalf(format string, v ...any) {
+	l.logger.Error(fmt.Sprintf(format, v...))
 }
@@ -0,0 +1,106 @@
+package migrator
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+type sqlMigration struct {
+	Header string
+	Up     []string
+	Down   []string
+	NoTx   bool
+}
+
+// parseSqlMigration splits a goose SQL migration into its up and down statements. It understands the
+// same annotations as goose (Up, Down, StatementBegin, StatementEnd and NO TRANSACTION). Comments before
+// the first annotation are returned as Header.
+func parseSqlMigration(s string) (*sqlMigration, error) {
+	ret := &sqlMigration{}
+
+	var header strings.Builder
+	var cur *[]string
+	var buf strings.Builder
+	inBlock := false
+	seenAnnotation := false
+
+	flush := func() {
+		stmt := strings.TrimSpace(buf.String())
+		buf.Reset()
+		if stmt != "" && cur != nil {
+			*cur = append(*cur, stmt)
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "-- +goose") {
+			seenAnnotation = true
+			cmd := strings.TrimSpace(strings.TrimPrefix(trimmed, "-- +goose"))
+			switch strings.ToLower(cmd) {
+			case "up":
+				flush()
+				cur = &ret.Up
+			case "down":
+				flush()
+				cur = &ret.Down
+			case "statementbegin":
+				flush()
+				inBlock = true
+			case "statementend":
+				inBlock = false
+				flush()
+			case "no transaction":
+				ret.NoTx = true
+			}
+			continue
+		}
+		if !seenAnnotation {
+			if strings.HasPrefix(trimmed, "--") {
+				header.WriteString(line)
+				header.WriteString("\n")
+			}
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if !inBlock && buf.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+
+		buf.WriteString(line)
+		buf.WriteString("\n")
+		if !inBlock && endsWithSemicolon(trimmed) {
+			flush()
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	if inBlock {
+		return nil, fmt.Errorf("missing StatementEnd annotation")
+	}
+	flush()
+
+	ret.Header = header.String()
+	return ret, nil
+}
+
+// endsWithSemicolon works like goose's implementation, which ignores trailing comments
+func endsWithSemicolon(line string) bool {
+	prev := ""
+	for _, word := range strings.Fields(line) {
+		if strings.HasPrefix(word, "--") {
+			break
+		}
+		prev = word
+	}
+	return strings.HasSuffix(prev, ";")
+}
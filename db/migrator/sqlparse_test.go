@@ -0,0 +1,111 @@
+package migrator
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSqlMigration(t *testing.T) {
+	tests := []struct {
+		name   string
+		sql    string
+		header string
+		up     []string
+		down   []string
+		noTx   bool
+	}{
+		{
+			name: "simple",
+			sql: `-- lint:allow drop-table
+-- +goose Up
+create table a (id integer);
+-- a comment between statements
+
+create index a_id on a (id); -- trailing comment
+
+-- +goose Down
+drop table a;
+`,
+			header: "-- lint:allow drop-table\n",
+			up:     []string{"create table a (id integer);", "create index a_id on a (id); -- trailing comment"},
+			down:   []string{"drop table a;"},
+		},
+		{
+			name: "statement block",
+			sql: `-- +goose Up
+-- +goose StatementBegin
+create function f() returns trigger as $$
+begin
+    new.x = 1;
+
+    return new;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+create table b (id integer);
+-- +goose Down
+-- +goose StatementBegin
+drop function f;
+-- +goose StatementEnd
+`,
+			up: []string{
+				"create function f() returns trigger as $$\nbegin\n    new.x = 1;\n\n    return new;\nend;\n$$ language plpgsql;",
+				"create table b (id integer);",
+			},
+			down: []string{"drop function f;"},
+		},
+		{
+			name: "dashes in string literals",
+			sql: `-- +goose Up
+insert into a (x, y) values ('--', 'a--b;');
+insert into a (x) values ('it''s -- not a comment');
+insert into a (x) values ('x');
+`,
+			up: []string{
+				"insert into a (x, y) values ('--', 'a--b;');",
+				// like goose, a word starting with -- ends the check for the terminating semicolon, so the
+				// statement continues on the next line
+				"insert into a (x) values ('it''s -- not a comment');\ninsert into a (x) values ('x');",
+			},
+		},
+		{
+			name: "no transaction",
+			sql: `-- +goose NO TRANSACTION
+-- +goose Up
+create index concurrently a_x on a (x);
+`,
+			up:   []string{"create index concurrently a_x on a (x);"},
+			noTx: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := parseSqlMigration(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Header != tc.header {
+				t.Errorf("expected header %q, got %q", tc.header, m.Header)
+			}
+			if !slices.Equal(m.Up, tc.up) {
+				t.Errorf("expected up statements %q, got %q", tc.up, m.Up)
+			}
+			if !slices.Equal(m.Down, tc.down) {
+				t.Errorf("expected down statements %q, got %q", tc.down, m.Down)
+			}
+			if m.NoTx != tc.noTx {
+				t.Errorf("expected NoTx=%v, got %v", tc.noTx, m.NoTx)
+			}
+		})
+	}
+}
+
+func TestParseSqlMigrationMissingStatementEnd(t *testing.T) {
+	_, err := parseSqlMigration(`-- +goose Up
+-- +goose StatementBegin
+select 1;
+`)
+	if err == nil {
+		t.Fatal("expected an error for a missing StatementEnd")
+	}
+}
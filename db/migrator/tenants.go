@@ -0,0 +1,244 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Tenant struct {
+	Id  string `json:"id"`
+	DSN string `json:"dsn"`
+	// DriverName defaults to sqlite3
+	DriverName string `json:"driver_name,omitempty"`
+}
+
+// TenantSource provides the list of tenant databases to migrate
+type TenantSource interface {
+	ListTenants(ctx context.Context) ([]Tenant, error)
+}
+
+type TenantSourceFunc func(ctx context.Context) ([]Tenant, error)
+
+func (f TenantSourceFunc) ListTenants(ctx context.Context) ([]Tenant, error) {
+	return f(ctx)
+}
+
+// StaticTenants returns a TenantSource for a fixed list of tenants
+func StaticTenants(tenants ...Tenant) TenantSource {
+	return TenantSourceFunc(func(ctx context.Context) ([]Tenant, error) {
+		return tenants, nil
+	})
+}
+
+// GlobTenants returns a TenantSource with one SQLite tenant per file matching pattern. The tenant id is the
+// file name without extension.
+func GlobTenants(pattern string) TenantSource {
+	return TenantSourceFunc(func(ctx context.Context) ([]Tenant, error) {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]Tenant, 0, len(matches))
+		for _, m := range matches {
+			base := filepath.Base(m)
+			ret = append(ret, Tenant{
+				Id:         strings.TrimSuffix(base, filepath.Ext(base)),
+				DSN:        m,
+				DriverName: "sqlite3",
+			})
+		}
+		return ret, nil
+	})
+}
+
+type TenantMigrateOptions struct {
+	// Parallelism is the maximum number of tenants migrated concurrently. Defaults to 4.
+	Parallelism int
+	// Options are passed to the migrator of each tenant. The logger gets a tenant attribute added.
+	Options Options
+	// OpenDB opens the tenant database. Defaults to sqlx.Open with the tenant's driver and DSN.
+	OpenDB func(ctx context.Context, t Tenant) (*sqlx.DB, error)
+	// OnResult is called after each tenant finished, e.g. to persist progress. It may be called concurrently.
+	// Tenants skipped because ctx was cancelled are passed with ctx.Err() as error.
+	OnResult func(r TenantResult)
+}
+
+type TenantResult struct {
+	Tenant        string            `json:"tenant"`
+	StartedAt     time.Time         `json:"started_at"`
+	Duration      time.Duration     `json:"duration"`
+	VersionBefore int64             `json:"version_before"`
+	VersionAfter  int64             `json:"version_after"`
+	Applied       []MigrationResult `json:"applied,omitempty"`
+	Error         string            `json:"error,omitempty"`
+
+	Err error `json:"-"`
+}
+
+type TenantReport struct {
+	StartedAt time.Time      `json:"started_at"`
+	Duration  time.Duration  `json:"duration"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Results   []TenantResult `json:"results"`
+}
+
+// FailedTenants returns the results of all tenants that failed to migrate
+func (r *TenantReport) FailedTenants() []TenantResult {
+	var ret []TenantResult
+	for _, x := range r.Results {
+		if x.Err != nil {
+			ret = append(ret, x)
+		}
+	}
+	return ret
+}
+
+// Err returns the joined errors of all failed tenants, or nil if all succeeded
+func (r *TenantReport) Err() error {
+	var errs []error
+	for _, x := range r.FailedTenants() {
+		errs = append(errs, fmt.Errorf("tenant %s: %w", x.Tenant, x.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// MigrateTenants applies all pending migrations to every tenant database returned by source, with bounded
+// parallelism. Failing tenants do not stop the others; check the returned report for per-tenant results.
+// The returned error is only set if the tenants could not be listed.
+func MigrateTenants(ctx context.Context, source TenantSource, migrations map[string]fs.FS, opts TenantMigrateOptions) (*TenantReport, error) {
+	tenants, err := source.ListTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = 4
+	}
+
+	report := &TenantReport{
+		StartedAt: time.Now(),
+		Results:   make([]TenantResult, len(tenants)),
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Parallelism)
+	for i, t := range tenants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var r TenantResult
+			select {
+			case sem <- struct{}{}:
+				r = migrateTenant(ctx, t, migrations, opts)
+				<-sem
+			case <-ctx.Done():
+				// skipped tenants are reported as well, so that OnResult sees every tenant
+				r = TenantResult{Tenant: t.Id, StartedAt: time.Now(), Err: ctx.Err(), Error: ctx.Err().Error()}
+			}
+
+			report.Results[i] = r
+			if opts.OnResult != nil {
+				opts.OnResult(r)
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(report.Results, func(i, j int) bool {
+		return report.Results[i].Tenant < report.Results[j].Tenant
+	})
+	for _, r := range report.Results {
+		if r.Err != nil {
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+	}
+	report.Duration = time.Since(report.StartedAt)
+
+	return report, nil
+}
+
+func migrateTenant(ctx context.Context, t Tenant, migrations map[string]fs.FS, opts TenantMigrateOptions) TenantResult {
+	r := TenantResult{
+		Tenant:    t.Id,
+		StartedAt: time.Now(),
+	}
+	r.Err = doMigrateTenant(ctx, t, migrations, opts, &r)
+	if r.Err != nil {
+		r.Error = r.Err.Error()
+	}
+	r.Duration = time.Since(r.StartedAt)
+	return r
+}
+
+func doMigrateTenant(ctx context.Context, t Tenant, migrations map[string]fs.FS, opts TenantMigrateOptions, r *TenantResult) error {
+	var db *sqlx.DB
+	var err error
+	if opts.OpenDB != nil {
+		db, err = opts.OpenDB(ctx, t)
+	} else {
+		driverName := t.DriverName
+		if driverName == "" {
+			driverName = "sqlite3"
+		}
+		db, err = sqlx.Open(driverName, t.DSN)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	mopts := opts.Options
+	log := mopts.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	log = log.With(slog.String("tenant", t.Id))
+	if mopts.Logger != nil {
+		mopts.Logger = log
+	}
+
+	m, err := New(db, migrations, mopts)
+	if err != nil {
+		return err
+	}
+
+	r.VersionBefore, err = m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+	r.VersionAfter = r.VersionBefore
+
+	r.Applied, err = m.Up(ctx)
+	if err != nil {
+		// earlier migrations might have been applied before the failure
+		if v, err2 := m.provider.GetDBVersion(ctx); err2 == nil {
+			r.VersionAfter = v
+		}
+		log.ErrorContext(ctx, "tenant migration failed", slog.Any("error", err))
+		return err
+	}
+
+	r.VersionAfter, err = m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if len(r.Applied) != 0 {
+		log.InfoContext(ctx, "migrated tenant",
+			slog.Int64("version_before", r.VersionBefore),
+			slog.Int64("version_after", r.VersionAfter),
+		)
+	}
+	return nil
+}
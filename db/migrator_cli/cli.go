@@ -0,0 +1,368 @@
+package migrator_cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dboxed/dboxed-common/db/migrator"
+	"github.com/dboxed/dboxed-common/db/querier"
+	"github.com/dboxed/dboxed-common/db/schema_verify"
+	"github.com/dboxed/dboxed-common/db/schematemplates"
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Config struct {
+	// DSN is the database to migrate. postgres:// and postgresql:// URLs use the pgx driver, everything else
+	// (e.g. sqlite3://path/to/db or a plain file path) uses sqlite3. Can be overridden with -dsn.
+	DSN string
+	// TemplatesDir contains the templated migration files. Can be overridden with -dir.
+	TemplatesDir string
+	// OutputDir is where render writes the rendered migrations, one sub-directory per db type. Can be
+	// overridden with -out.
+	OutputDir string
+
+	// Verifier is used by the verify command to compare models with the live schema. If nil, verify only
+	// checks the rendered migrations for drift.
+	Verifier *schema_verify.Verifier
+	// Options are passed to the migrator
+	Options migrator.Options
+
+	Out io.Writer
+}
+
+// CLI implements the render, migrate, create, verify and lint commands. It can be run standalone (see
+// cmd/dboxed-migrate) or embedded as a subcommand of an existing CLI by passing the remaining arguments to
+// Run, e.g. from a cobra command with DisableFlagParsing enabled.
+type CLI struct {
+	cfg Config
+}
+
+func New(cfg Config) *CLI {
+	if cfg.Out == nil {
+		cfg.Out = os.Stdout
+	}
+	return &CLI{cfg: cfg}
+}
+
+const usage = `Usage: <command> [flags]
+
+Commands:
+  render                        render the migration templates into the output directory
+  migrate up [-to version]      apply pending migrations
+  migrate down [-to version]    roll back the last migration or all migrations after version
+  migrate redo                  roll back and re-apply the last migration
+  migrate status                show applied and pending migrations
+  create <name>                 create a new timestamped migration template
+  verify                        check rendered migrations and models for drift
+  lint                          lint the migrations for portability and destructive operations
+
+Global flags:
+  -dsn string    database DSN
+  -dir string    migration templates directory
+  -out string    rendered migrations directory
+`
+
+func (c *CLI) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		_, _ = fmt.Fprint(c.cfg.Out, usage)
+		return fmt.Errorf("missing command")
+	}
+
+	switch args[0] {
+	case "render":
+		return c.runRender(args[1:])
+	case "migrate":
+		if len(args) < 2 {
+			return fmt.Errorf("missing migrate sub-command (up, down, redo or status)")
+		}
+		return c.runMigrate(ctx, args[1], args[2:])
+	case "create":
+		return c.runCreate(args[1:])
+	case "verify":
+		return c.runVerify(ctx, args[1:])
+	case "lint":
+		return c.runLint(args[1:])
+	case "help", "-h", "-help", "--help":
+		_, _ = fmt.Fprint(c.cfg.Out, usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+}
+
+type commonFlags struct {
+	dsn     string
+	dir     string
+	out     string
+	json    bool
+	dryRun  bool
+	version int64
+}
+
+func (c *CLI) parseFlags(name string, args []string, extra func(fs *flag.FlagSet, f *commonFlags)) (*commonFlags, []string, error) {
+	f := &commonFlags{}
+	fset := flag.NewFlagSet(name, flag.ContinueOnError)
+	fset.SetOutput(c.cfg.Out)
+	fset.StringVar(&f.dsn, "dsn", c.cfg.DSN, "database DSN")
+	fset.StringVar(&f.dir, "dir", c.cfg.TemplatesDir, "migration templates directory")
+	fset.StringVar(&f.out, "out", c.cfg.OutputDir, "rendered migrations directory")
+	if extra != nil {
+		extra(fset, f)
+	}
+	err := fset.Parse(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.dir == "" {
+		return nil, nil, fmt.Errorf("missing migration templates directory")
+	}
+	return f, fset.Args(), nil
+}
+
+func openDB(dsn string) (*sqlx.DB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("missing database DSN")
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return sqlx.Open("pgx", dsn)
+	}
+	return sqlx.Open("sqlite3", strings.TrimPrefix(dsn, "sqlite3://"))
+}
+
+func (c *CLI) printJson(v any) error {
+	enc := json.NewEncoder(c.cfg.Out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (c *CLI) runRender(args []string) error {
+	f, _, err := c.parseFlags("render", args, nil)
+	if err != nil {
+		return err
+	}
+	if f.out == "" {
+		return fmt.Errorf("missing output directory")
+	}
+	for _, dbType := range []string{"postgres", "sqlite"} {
+		targetDir := filepath.Join(f.out, dbType)
+		err = schematemplates.RenderSchemas(os.DirFS(f.dir), targetDir, dbType)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(c.cfg.Out, "rendered %s migrations into %s\n", dbType, targetDir)
+	}
+	return nil
+}
+
+func (c *CLI) runMigrate(ctx context.Context, cmd string, args []string) error {
+	f, _, err := c.parseFlags("migrate "+cmd, args, func(fs *flag.FlagSet, f *commonFlags) {
+		fs.BoolVar(&f.json, "json", false, "print results as JSON")
+		if cmd != "status" {
+			fs.BoolVar(&f.dryRun, "dry-run", false, "only print the statements that would be executed")
+		}
+		if cmd == "up" || cmd == "down" {
+			fs.Int64Var(&f.version, "to", -1, "target version")
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(f.dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := migrator.NewFromTemplates(db, os.DirFS(f.dir), c.cfg.Options)
+	if err != nil {
+		return err
+	}
+
+	if cmd == "status" {
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		if f.json {
+			return c.printJson(status)
+		}
+		w := tabwriter.NewWriter(c.cfg.Out, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tSOURCE")
+		for _, s := range status {
+			appliedAt := "-"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.State, appliedAt, s.Source)
+		}
+		return w.Flush()
+	}
+
+	var res []migrator.MigrationResult
+	switch cmd {
+	case "up":
+		if f.version < 0 {
+			f.version = 1<<63 - 1
+		}
+		res, err = m.UpTo(ctx, f.version, f.dryRun)
+	case "down":
+		if f.version < 0 {
+			res, err = m.Down(ctx, f.dryRun)
+		} else {
+			res, err = m.DownTo(ctx, f.version, f.dryRun)
+		}
+	case "redo":
+		res, err = m.Redo(ctx, f.dryRun)
+	default:
+		return fmt.Errorf("unknown migrate sub-command %s", cmd)
+	}
+	if f.json {
+		return errors.Join(err, c.printJson(res))
+	}
+	for _, r := range res {
+		_, _ = fmt.Fprintf(c.cfg.Out, "%-4s %d %s (%s)\n", r.Direction, r.Version, r.Source, r.Duration)
+		for _, s := range r.Statements {
+			_, _ = fmt.Fprintf(c.cfg.Out, "  %s\n", strings.ReplaceAll(s, "\n", "\n  "))
+		}
+	}
+	if err == nil && len(res) == 0 {
+		_, _ = fmt.Fprintln(c.cfg.Out, "no migrations to run")
+	}
+	return err
+}
+
+const newMigrationTemplate = `-- +goose Up
+
+-- +goose Down
+`
+
+func (c *CLI) runCreate(args []string) error {
+	f, rest, err := c.parseFlags("create", args, nil)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one migration name")
+	}
+	err = os.MkdirAll(f.dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s_%s.sql", time.Now().UTC().Format("20060102150405"), rest[0])
+	path := filepath.Join(f.dir, name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(newMigrationTemplate)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(c.cfg.Out, "created %s\n", path)
+	return file.Close()
+}
+
+func (c *CLI) runVerify(ctx context.Context, args []string) error {
+	f, _, err := c.parseFlags("verify", args, nil)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	if f.out != "" {
+		rendered, err := schematemplates.RenderMigrations(os.DirFS(f.dir))
+		if err != nil {
+			return err
+		}
+		for driverName, r := range rendered {
+			dbType, _ := schematemplates.DbTypeForDriver(driverName)
+			generatedDir := filepath.Join(f.out, dbType)
+			if _, err := os.Stat(generatedDir); err != nil {
+				continue
+			}
+			err = schematemplates.CheckDrift(r, os.DirFS(generatedDir))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", generatedDir, err))
+			}
+		}
+	}
+
+	if c.cfg.Verifier != nil {
+		db, err := openDB(f.dsn)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		issues, err := c.cfg.Verifier.Verify(querier.NewQuerier(ctx, db, nil))
+		if err != nil {
+			return err
+		}
+		for _, i := range issues {
+			errs = append(errs, errors.New(i.String()))
+		}
+	}
+
+	for _, err := range errs {
+		_, _ = fmt.Fprintln(c.cfg.Out, err.Error())
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("verification found %d problems", len(errs))
+	}
+	_, _ = fmt.Fprintln(c.cfg.Out, "no problems found")
+	return nil
+}
+
+func (c *CLI) runLint(args []string) error {
+	f, _, err := c.parseFlags("lint", args, func(fs *flag.FlagSet, f *commonFlags) {
+		fs.BoolVar(&f.json, "json", false, "print issues as JSON")
+	})
+	if err != nil {
+		return err
+	}
+
+	rendered, err := schematemplates.RenderMigrations(os.DirFS(f.dir))
+	if err != nil {
+		return err
+	}
+	issues, err := migrator.Lint(rendered)
+	if err != nil {
+		return err
+	}
+
+	errorCount := 0
+	for _, i := range issues {
+		if i.Severity == migrator.LintError {
+			errorCount++
+		}
+	}
+	if f.json {
+		err = c.printJson(issues)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, i := range issues {
+			_, _ = fmt.Fprintln(c.cfg.Out, i.String())
+		}
+	}
+	if errorCount != 0 {
+		return fmt.Errorf("lint found %d errors", errorCount)
+	}
+	return nil
+}
@@ -40,6 +40,10 @@ func GetTX(c context.Context) *sqlx.Tx {
 	return getTX(c, true)
 }
 
+func HasTX(c context.Context) bool {
+	return getTX(c, false) != nil
+}
+
 func GetQuerier(c context.Context) *Querier {
 	tx := getTX(c, false)
 	var tx2 *sqlx.Tx
@@ -3,6 +3,8 @@ package querier
 import (
 	"database/sql"
 	"errors"
+	"regexp"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -34,3 +36,132 @@ func IsSqlConstraintViolationError(err error) bool {
 
 	return false
 }
+
+// IsSqlSerializationError returns true if err is a serialization failure or deadlock, meaning that the
+// transaction can be retried
+func IsSqlSerializationError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// serialization_failure and deadlock_detected
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+
+	return false
+}
+
+type SqlConstraintKind string
+
+const (
+	SqlUniqueViolation     SqlConstraintKind = "unique_violation"
+	SqlForeignKeyViolation SqlConstraintKind = "foreign_key_violation"
+	SqlNotNullViolation    SqlConstraintKind = "not_null_violation"
+	SqlCheckViolation      SqlConstraintKind = "check_violation"
+)
+
+// SqlConstraintError describes a constraint violation. Which fields are set depends on the database, e.g.
+// sqlite does not report constraint names for unique violations and nothing for foreign key violations.
+type SqlConstraintError struct {
+	Kind       SqlConstraintKind
+	Constraint string
+	Table      string
+	Columns    []string
+	// StillReferenced and ReferenceMissing tell whether a foreign key violation was caused by deleting a
+	// referenced row or by referencing a missing row. Only detected on postgres.
+	StillReferenced  bool
+	ReferenceMissing bool
+}
+
+var pgKeyColumnsRegex = regexp.MustCompile(`^Key \((.+?)\)=\(`)
+
+// pgColumnNameRegex matches plain or quoted column names, but not expressions like lower(name::text)
+var pgColumnNameRegex = regexp.MustCompile(`^(?:[A-Za-z_][A-Za-z0-9_$]*|"(?:[^"]|"")+")$`)
+var sqliteConstraintRegex = regexp.MustCompile(`^(?:UNIQUE|NOT NULL|CHECK) constraint failed: (.*)$`)
+
+// ParseSqlConstraintError returns details about the constraint violation in err, or nil if err is not a
+// constraint violation
+func ParseSqlConstraintError(err error) *SqlConstraintError {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		ret := &SqlConstraintError{
+			Constraint: pgErr.ConstraintName,
+			Table:      pgErr.TableName,
+		}
+		switch pgErr.Code {
+		case "23505":
+			ret.Kind = SqlUniqueViolation
+		case "23503":
+			ret.Kind = SqlForeignKeyViolation
+			ret.StillReferenced = strings.Contains(pgErr.Detail, "is still referenced")
+			ret.ReferenceMissing = strings.Contains(pgErr.Detail, "is not present")
+		case "23502":
+			ret.Kind = SqlNotNullViolation
+		case "23514":
+			ret.Kind = SqlCheckViolation
+		default:
+			return nil
+		}
+		if pgErr.ColumnName != "" {
+			ret.Columns = []string{pgErr.ColumnName}
+		} else if m := pgKeyColumnsRegex.FindStringSubmatch(pgErr.Detail); m != nil {
+			ret.Columns = parsePgKeyColumns(m[1])
+		}
+		return ret
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		ret := &SqlConstraintError{}
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			ret.Kind = SqlUniqueViolation
+		case sqlite3.ErrConstraintForeignKey:
+			ret.Kind = SqlForeignKeyViolation
+		case sqlite3.ErrConstraintNotNull:
+			ret.Kind = SqlNotNullViolation
+		case sqlite3.ErrConstraintCheck:
+			ret.Kind = SqlCheckViolation
+		default:
+			return nil
+		}
+		// e.g. "UNIQUE constraint failed: box.name, box.other" or "CHECK constraint failed: name_check"
+		if m := sqliteConstraintRegex.FindStringSubmatch(sqliteErr.Error()); m != nil {
+			if ret.Kind == SqlCheckViolation {
+				ret.Constraint = m[1]
+			} else {
+				for _, c := range strings.Split(m[1], ",") {
+					table, column, ok := strings.Cut(strings.TrimSpace(c), ".")
+					if !ok {
+						continue
+					}
+					ret.Table = table
+					ret.Columns = append(ret.Columns, column)
+				}
+			}
+		}
+		return ret
+	}
+
+	return nil
+}
+
+// parsePgKeyColumns parses the column list of a pg key detail, e.g. `name, "Other"`. Unique indexes on
+// expressions have no plain column list, nil is returned for them.
+func parsePgKeyColumns(s string) []string {
+	var ret []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if !pgColumnNameRegex.MatchString(c) {
+			return nil
+		}
+		if strings.HasPrefix(c, `"`) {
+			c = strings.ReplaceAll(c[1:len(c)-1], `""`, `"`)
+		}
+		ret = append(ret, c)
+	}
+	return ret
+}
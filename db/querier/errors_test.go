@@ -0,0 +1,113 @@
+package querier
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+)
+
+func newConstraintTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db := sqlx.MustOpen("sqlite3", "file::memory:?_foreign_keys=1")
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	db.MustExec(`create table parent (id integer primary key, name text not null, other text not null, unique (name, other))`)
+	db.MustExec(`create table child (id integer primary key, parent_id integer not null references parent (id))`)
+	db.MustExec(`insert into parent (id, name, other) values (1, 'a', 'b')`)
+	db.MustExec(`insert into child (id, parent_id) values (1, 1)`)
+	return db
+}
+
+func TestParseSqlConstraintErrorSqlite(t *testing.T) {
+	db := newConstraintTestDB(t)
+
+	tests := []struct {
+		name    string
+		query   string
+		kind    SqlConstraintKind
+		table   string
+		columns []string
+	}{
+		{"unique", `insert into parent (id, name, other) values (2, 'a', 'b')`, SqlUniqueViolation, "parent", []string{"name", "other"}},
+		{"primary key", `insert into parent (id, name, other) values (1, 'x', 'y')`, SqlUniqueViolation, "parent", []string{"id"}},
+		{"missing reference", `insert into child (id, parent_id) values (2, 42)`, SqlForeignKeyViolation, "", nil},
+		{"still referenced", `delete from parent where id = 1`, SqlForeignKeyViolation, "", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := db.Exec(tc.query)
+			if err == nil {
+				t.Fatal("expected a constraint violation")
+			}
+			c := ParseSqlConstraintError(fmt.Errorf("wrapped: %w", err))
+			if c == nil {
+				t.Fatalf("expected a constraint error for %v", err)
+			}
+			if c.Kind != tc.kind || c.Table != tc.table || !slices.Equal(c.Columns, tc.columns) {
+				t.Fatalf("unexpected constraint error %+v for %v", c, err)
+			}
+		})
+	}
+}
+
+func TestParseSqlConstraintErrorPg(t *testing.T) {
+	tests := []struct {
+		name             string
+		err              *pgconn.PgError
+		kind             SqlConstraintKind
+		columns          []string
+		stillReferenced  bool
+		referenceMissing bool
+	}{
+		{
+			name: "unique",
+			err: &pgconn.PgError{Code: "23505", ConstraintName: "box_name_key", TableName: "box",
+				Detail: `Key (name, "Other ""x""")=(a, b) already exists.`},
+			kind:    SqlUniqueViolation,
+			columns: []string{"name", `Other "x"`},
+		},
+		{
+			name: "unique expression index",
+			err: &pgconn.PgError{Code: "23505", ConstraintName: "box_lower_name", TableName: "box",
+				Detail: `Key (lower(name::text))=(a) already exists.`},
+			kind: SqlUniqueViolation,
+		},
+		{
+			name: "missing reference",
+			err: &pgconn.PgError{Code: "23503", ConstraintName: "child_parent_id_fkey", TableName: "child",
+				Detail: `Key (parent_id)=(42) is not present in table "parent".`},
+			kind:             SqlForeignKeyViolation,
+			columns:          []string{"parent_id"},
+			referenceMissing: true,
+		},
+		{
+			name: "still referenced",
+			err: &pgconn.PgError{Code: "23503", ConstraintName: "child_parent_id_fkey", TableName: "parent",
+				Detail: `Key (id)=(1) is still referenced from table "child".`},
+			kind:            SqlForeignKeyViolation,
+			columns:         []string{"id"},
+			stillReferenced: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := ParseSqlConstraintError(fmt.Errorf("wrapped: %w", tc.err))
+			if c == nil {
+				t.Fatal("expected a constraint error")
+			}
+			if c.Kind != tc.kind || c.Constraint != tc.err.ConstraintName || c.Table != tc.err.TableName ||
+				!slices.Equal(c.Columns, tc.columns) ||
+				c.StillReferenced != tc.stillReferenced || c.ReferenceMissing != tc.referenceMissing {
+				t.Fatalf("unexpected constraint error %+v", c)
+			}
+		})
+	}
+
+	if c := ParseSqlConstraintError(&pgconn.PgError{Code: "40001"}); c != nil {
+		t.Fatalf("expected nil for a non-constraint error, got %+v", c)
+	}
+}
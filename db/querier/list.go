@@ -0,0 +1,357 @@
+package querier
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+type FilterOp string
+
+const (
+	FilterEq   FilterOp = "eq"
+	FilterNe   FilterOp = "ne"
+	FilterLt   FilterOp = "lt"
+	FilterLe   FilterOp = "le"
+	FilterGt   FilterOp = "gt"
+	FilterGe   FilterOp = "ge"
+	FilterLike FilterOp = "like"
+	// FilterIn expects a slice as value
+	FilterIn FilterOp = "in"
+	// FilterNull expects a bool as value, true meaning "is null" and false "is not null"
+	FilterNull FilterOp = "null"
+)
+
+var FilterOps = []FilterOp{FilterEq, FilterNe, FilterLt, FilterLe, FilterGt, FilterGe, FilterLike, FilterIn, FilterNull}
+
+var filterOpSql = map[FilterOp]string{
+	FilterEq:   "=",
+	FilterNe:   "<>",
+	FilterLt:   "<",
+	FilterLe:   "<=",
+	FilterGt:   ">",
+	FilterGe:   ">=",
+	FilterLike: "like",
+}
+
+type Filter struct {
+	Field string
+	Op    FilterOp
+	Value any
+}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+type PageQuery struct {
+	Filters []Filter
+	Sort    []SortField
+	// Limit is the maximum number of items to return. 0 means no limit.
+	Limit  int
+	Offset int
+	// Cursor is a NextCursor or PrevCursor from a previous page. Can't be combined with Offset.
+	Cursor string
+}
+
+type Page[T any] struct {
+	Items      []T
+	TotalCount int
+	// NextCursor and PrevCursor are empty if there is no next/previous page
+	NextCursor string
+	PrevCursor string
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type pageCursor struct {
+	Values   []json.RawMessage `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+}
+
+// BuildFilterWhere builds a where clause from the given filters, which are all combined with "and"
+func BuildFilterWhere[T any](filters []Filter) (string, map[string]any, error) {
+	dbFields, _ := GetStructDBFields[T]()
+
+	var where []string
+	args := map[string]any{}
+	for i, f := range filters {
+		df, ok := dbFields[f.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("field %s not found", f.Field)
+		}
+		argName := fmt.Sprintf("_filter_%d", i)
+
+		switch f.Op {
+		case FilterNull:
+			isNull, ok := f.Value.(bool)
+			if !ok {
+				return "", nil, fmt.Errorf("filter %s on %s expects a bool", f.Op, f.Field)
+			}
+			if isNull {
+				where = append(where, fmt.Sprintf("%s is null", df.SelectName))
+			} else {
+				where = append(where, fmt.Sprintf("%s is not null", df.SelectName))
+			}
+		case FilterIn:
+			v := reflect.ValueOf(f.Value)
+			if v.Kind() != reflect.Slice {
+				return "", nil, fmt.Errorf("filter %s on %s expects a slice", f.Op, f.Field)
+			}
+			if v.Len() == 0 {
+				where = append(where, "1 = 0")
+				continue
+			}
+			var names []string
+			for j := range v.Len() {
+				n := fmt.Sprintf("%s_%d", argName, j)
+				names = append(names, ":"+n)
+				args[n] = v.Index(j).Interface()
+			}
+			where = append(where, fmt.Sprintf("%s in (%s)", df.SelectName, strings.Join(names, ", ")))
+		default:
+			op, ok := filterOpSql[f.Op]
+			if !ok {
+				return "", nil, fmt.Errorf("unknown filter op %s", f.Op)
+			}
+			where = append(where, fmt.Sprintf("%s %s :%s", df.SelectName, op, argName))
+			args[argName] = f.Value
+		}
+	}
+
+	return strings.Join(where, " and "), args, nil
+}
+
+// IsNullableField returns true if the field can hold NULL, i.e. it is a pointer, a sql.Null[T] like struct or
+// belongs to a left join
+func IsNullableField(f StructDBField) bool {
+	if f.Join != nil && f.Join.Type == "left" {
+		return true
+	}
+	t := f.StructField.Type
+	if t.Kind() == reflect.Pointer {
+		return true
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	_, hasValid := t.FieldByName("Valid")
+	return hasValid
+}
+
+// GetPage returns a page of rows matching byFields and pq.Filters, ordered by pq.Sort. The id field is added as
+// last sort field (if the struct has one) so that the order and thus the cursors are stable. Nullable fields
+// can't be used for sorting.
+func GetPage[T any](q *Querier, byFields map[string]any, pq PageQuery) (*Page[T], error) {
+	if pq.Cursor != "" && pq.Offset != 0 {
+		return nil, fmt.Errorf("cursor and offset can't be combined")
+	}
+	dbFields, _ := GetStructDBFields[T]()
+
+	where1, args, err := BuildWhere[T](byFields)
+	if err != nil {
+		return nil, err
+	}
+	where2, args2, err := BuildFilterWhere[T](pq.Filters)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range args2 {
+		args[k] = v
+	}
+	var wheres []string
+	for _, w := range []string{where1, where2} {
+		if w != "" {
+			wheres = append(wheres, w)
+		}
+	}
+
+	countQuery, err := BuildSelectWhereQuery[T](strings.Join(wheres, " and "))
+	if err != nil {
+		return nil, err
+	}
+	var totalCount int
+	err = q.GetNamed(&totalCount, fmt.Sprintf("select count(*) from (%s) as t", countQuery), args)
+	if err != nil {
+		return nil, err
+	}
+
+	sort := slices.Clone(pq.Sort)
+	if _, ok := dbFields["id"]; ok && !slices.ContainsFunc(sort, func(s SortField) bool { return s.Field == "id" }) {
+		sort = append(sort, SortField{Field: "id"})
+	}
+	sortFields := make([]StructDBField, 0, len(sort))
+	for _, s := range sort {
+		df, ok := dbFields[s.Field]
+		if !ok {
+			return nil, fmt.Errorf("field %s not found", s.Field)
+		}
+		if IsNullableField(df) {
+			// keyset conditions never match NULLs, so rows would be skipped when paging with cursors
+			return nil, fmt.Errorf("can't sort by nullable field %s", s.Field)
+		}
+		sortFields = append(sortFields, df)
+	}
+
+	backward := false
+	if pq.Cursor != "" {
+		if len(sort) == 0 {
+			return nil, fmt.Errorf("cursor pagination requires a sort order")
+		}
+		c, err := decodePageCursor(pq.Cursor, sortFields)
+		if err != nil {
+			return nil, err
+		}
+		backward = c.backward
+		w := buildKeysetWhere(sort, sortFields, c.values, backward, args)
+		wheres = append(wheres, w)
+	}
+
+	query, err := BuildSelectWhereQuery[T](strings.Join(wheres, " and "))
+	if err != nil {
+		return nil, err
+	}
+	if len(sort) != 0 {
+		var orderBy []string
+		for i, s := range sort {
+			desc := s.Desc != backward
+			dir := "asc"
+			if desc {
+				dir = "desc"
+			}
+			orderBy = append(orderBy, fmt.Sprintf("%s %s", sortFields[i].SelectName, dir))
+		}
+		query += "\norder by " + strings.Join(orderBy, ", ")
+	}
+	if pq.Limit > 0 {
+		// fetch one more to find out if there is a next page
+		query += fmt.Sprintf("\nlimit %d", pq.Limit+1)
+	}
+	if pq.Offset > 0 {
+		if pq.Limit <= 0 && q.E.DriverName() == "sqlite3" {
+			// sqlite does not allow offset without limit
+			query += "\nlimit -1"
+		}
+		query += fmt.Sprintf("\noffset %d", pq.Offset)
+	}
+
+	var items []T
+	err = q.SelectNamed(&items, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := pq.Limit > 0 && len(items) > pq.Limit
+	if hasMore {
+		items = items[:pq.Limit]
+	}
+	if backward {
+		slices.Reverse(items)
+	}
+
+	ret := &Page[T]{
+		Items:      items,
+		TotalCount: totalCount,
+	}
+	if len(items) == 0 || len(sort) == 0 {
+		return ret, nil
+	}
+
+	hasNext, hasPrev := hasMore, pq.Cursor != "" || pq.Offset > 0
+	if backward {
+		hasNext, hasPrev = true, hasMore
+	}
+	if hasNext {
+		ret.NextCursor, err = encodePageCursor(&items[len(items)-1], sortFields, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hasPrev {
+		ret.PrevCursor, err = encodePageCursor(&items[0], sortFields, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// buildKeysetWhere builds "(s1 > v1) or (s1 = v1 and s2 > v2) or ..." with the comparison direction depending
+// on the sort direction
+func buildKeysetWhere(sort []SortField, sortFields []StructDBField, values []any, backward bool, args map[string]any) string {
+	var ors []string
+	for i := range sort {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, fmt.Sprintf("%s = :_cursor_%d", sortFields[j].SelectName, j))
+		}
+		op := ">"
+		if sort[i].Desc != backward {
+			op = "<"
+		}
+		ands = append(ands, fmt.Sprintf("%s %s :_cursor_%d", sortFields[i].SelectName, op, i))
+		ors = append(ors, "("+strings.Join(ands, " and ")+")")
+	}
+	for i, v := range values {
+		args[fmt.Sprintf("_cursor_%d", i)] = v
+	}
+	return "(" + strings.Join(ors, " or ") + ")"
+}
+
+func encodePageCursor[T any](item *T, sortFields []StructDBField, backward bool) (string, error) {
+	c := pageCursor{
+		Backward: backward,
+	}
+	for _, f := range sortFields {
+		v := GetStructValueByPath(item, f.Path).Interface()
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, b)
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type decodedPageCursor struct {
+	values   []any
+	backward bool
+}
+
+func decodePageCursor(s string, sortFields []StructDBField) (*decodedPageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	var c pageCursor
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	if len(c.Values) != len(sortFields) {
+		return nil, fmt.Errorf("%w: cursor does not match sort order", ErrInvalidCursor)
+	}
+
+	ret := &decodedPageCursor{
+		backward: c.Backward,
+	}
+	for i, f := range sortFields {
+		// decode into the field type so that the driver gets the same type as when comparing with the column
+		v := reflect.New(f.StructField.Type)
+		err = json.Unmarshal(c.Values[i], v.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+		}
+		ret.values = append(ret.values, v.Elem().Interface())
+	}
+	return ret, nil
+}
@@ -0,0 +1,168 @@
+package querier
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type pageTestRow struct {
+	Id    int64  `db:"id"`
+	Name  string `db:"name"`
+	Score int64  `db:"score"`
+}
+
+// pageTestScores has many ties, so that paging depends on the id tie-breaker
+var pageTestScores = []int64{3, 1, 2, 3, 1, 2, 3, 1, 2, 3}
+
+func newPageTestQuerier(t *testing.T) *Querier {
+	t.Helper()
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	db.MustExec(`create table page_test_row (id integer primary key, name text not null, score integer not null)`)
+	for i, s := range pageTestScores {
+		db.MustExec(`insert into page_test_row (id, name, score) values (?, ?, ?)`, i+1, "row", s)
+	}
+	return NewQuerier(context.Background(), db, nil)
+}
+
+func pageIds(items []pageTestRow) []int64 {
+	ret := make([]int64, 0, len(items))
+	for _, r := range items {
+		ret = append(ret, r.Id)
+	}
+	return ret
+}
+
+func expectedPageOrder(desc bool) []int64 {
+	rows := make([]pageTestRow, 0, len(pageTestScores))
+	for i, s := range pageTestScores {
+		rows = append(rows, pageTestRow{Id: int64(i + 1), Score: s})
+	}
+	slices.SortFunc(rows, func(a, b pageTestRow) int {
+		c := cmp.Compare(a.Score, b.Score)
+		if desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return pageIds(rows)
+}
+
+func TestGetPageCursors(t *testing.T) {
+	q := newPageTestQuerier(t)
+
+	for _, desc := range []bool{false, true} {
+		sort := []SortField{{Field: "score", Desc: desc}}
+		expected := expectedPageOrder(desc)
+
+		// forward through all pages
+		var pages []*Page[pageTestRow]
+		var forward []int64
+		cursor := ""
+		for {
+			p, err := GetPage[pageTestRow](q, nil, PageQuery{Sort: sort, Limit: 3, Cursor: cursor})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.TotalCount != len(pageTestScores) {
+				t.Fatalf("desc=%v: expected total count %d, got %d", desc, len(pageTestScores), p.TotalCount)
+			}
+			pages = append(pages, p)
+			forward = append(forward, pageIds(p.Items)...)
+			if p.NextCursor == "" {
+				break
+			}
+			if len(pages) > len(pageTestScores) {
+				t.Fatalf("desc=%v: paging forward does not terminate", desc)
+			}
+			cursor = p.NextCursor
+		}
+		if !slices.Equal(forward, expected) {
+			t.Fatalf("desc=%v: expected forward order %v, got %v", desc, expected, forward)
+		}
+		if pages[0].PrevCursor != "" {
+			t.Errorf("desc=%v: first page has a previous cursor", desc)
+		}
+		if len(pages) != 4 {
+			t.Fatalf("desc=%v: expected 4 pages, got %d", desc, len(pages))
+		}
+
+		// backward from the last page, which must return the same pages
+		p := pages[len(pages)-1]
+		for i := len(pages) - 2; i >= 0; i-- {
+			if p.PrevCursor == "" {
+				t.Fatalf("desc=%v: page %d has no previous cursor", desc, i+1)
+			}
+			var err error
+			p, err = GetPage[pageTestRow](q, nil, PageQuery{Sort: sort, Limit: 3, Cursor: p.PrevCursor})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(pageIds(p.Items), pageIds(pages[i].Items)) {
+				t.Fatalf("desc=%v: expected page %d to be %v when paging backward, got %v", desc, i, pageIds(pages[i].Items), pageIds(p.Items))
+			}
+			if p.NextCursor == "" {
+				t.Errorf("desc=%v: page %d has no next cursor when paging backward", desc, i)
+			}
+		}
+		if p.PrevCursor != "" {
+			t.Errorf("desc=%v: first page has a previous cursor when paging backward", desc)
+		}
+	}
+}
+
+func TestGetPageCursorWithFilter(t *testing.T) {
+	q := newPageTestQuerier(t)
+
+	pq := PageQuery{
+		Filters: []Filter{{Field: "score", Op: FilterGe, Value: 2}},
+		Sort:    []SortField{{Field: "score", Desc: true}},
+		Limit:   4,
+	}
+	p1, err := GetPage[pageTestRow](q, nil, pq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pq.Cursor = p1.NextCursor
+	p2, err := GetPage[pageTestRow](q, nil, pq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := append(pageIds(p1.Items), pageIds(p2.Items)...)
+	expected := []int64{1, 4, 7, 10, 3, 6, 9}
+	if !slices.Equal(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	if p2.TotalCount != 7 || p2.NextCursor != "" || p2.PrevCursor == "" {
+		t.Fatalf("unexpected last page: total=%d next=%q prev=%q", p2.TotalCount, p2.NextCursor, p2.PrevCursor)
+	}
+}
+
+func TestGetPageInvalidCursor(t *testing.T) {
+	q := newPageTestQuerier(t)
+
+	p, err := GetPage[pageTestRow](q, nil, PageQuery{Sort: []SortField{{Field: "score"}}, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a cursor of a different sort order has a different number of values
+	_, err = GetPage[pageTestRow](q, nil, PageQuery{Sort: []SortField{{Field: "score"}, {Field: "name"}}, Limit: 3, Cursor: p.NextCursor})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+	_, err = GetPage[pageTestRow](q, nil, PageQuery{Sort: []SortField{{Field: "score"}}, Limit: 3, Cursor: "not-a-cursor!"})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
@@ -18,7 +18,8 @@ import (
 type Querier struct {
 	Ctx context.Context
 	DB  *sqlx.DB
-	TX  *sqlx.Tx
+	// TX is nil if the querier runs outside a transaction or on a plain *sql.Tx, see NewQuerierFromSqlTx
+	TX *sqlx.Tx
 
 	E sqlx.ExtContext
 }
@@ -27,6 +28,11 @@ func (q *Querier) GetDB() *sqlx.DB {
 	return q.DB
 }
 
+// InTx returns true if the querier runs in a transaction
+func (q *Querier) InTx() bool {
+	return q.E != sqlx.ExtContext(q.DB)
+}
+
 func (q *Querier) selectDriverQuery(query any) string {
 	var resolvedQuery string
 	if queryStr, ok := query.(string); ok {
@@ -127,13 +133,18 @@ func (q *Querier) ExecOneNamed(query string, arg interface{}) error {
 }
 
 func Create[T any](q *Querier, v *T) error {
-	return createOrUpdate(q, v, false, "")
+	return createOrUpdate(q, v, false, "", "")
 }
 func CreateOrUpdate[T any](q *Querier, v *T, constraint string) error {
-	return createOrUpdate(q, v, true, constraint)
+	return createOrUpdate(q, v, true, constraint, "")
+}
+
+// CreateOrUpdateWhere is like CreateOrUpdate, but with a conflict target that matches a partial unique index
+func CreateOrUpdateWhere[T any](q *Querier, v *T, constraint string, indexWhere string) error {
+	return createOrUpdate(q, v, true, constraint, indexWhere)
 }
 
-func createOrUpdate[T any](q *Querier, v *T, allowUpdate bool, constraint string) error {
+func createOrUpdate[T any](q *Querier, v *T, allowUpdate bool, constraint string, indexWhere string) error {
 	t := reflect.TypeFor[T]()
 	table := GetTableName2(t)
 	fields, _ := GetStructDBFields[T]()
@@ -169,10 +180,11 @@ func createOrUpdate[T any](q *Querier, v *T, allowUpdate bool, constraint string
 		strings.Join(argsNames, ", "),
 	)
 	if allowUpdate {
-		query += fmt.Sprintf(` on conflict(%s) do update set %s`,
-			constraint,
-			strings.Join(conflictSets, ", "),
-		)
+		query += fmt.Sprintf(` on conflict(%s)`, constraint)
+		if indexWhere != "" {
+			query += fmt.Sprintf(` where %s`, indexWhere)
+		}
+		query += fmt.Sprintf(` do update set %s`, strings.Join(conflictSets, ", "))
 	}
 	query += fmt.Sprintf(" returning %s", strings.Join(returningFieldNames, ", "))
 
@@ -330,6 +342,49 @@ func BuildSelectWhereQuery[T any](where string) (string, error) {
 	return query, nil
 }
 
+// SelectOptions adds ordering, a limit and row locking to the generated select queries
+type SelectOptions struct {
+	OrderBy []SortField
+	// Limit is the maximum number of rows to return. 0 means no limit.
+	Limit int
+	// ForUpdate locks the selected rows of the main table until the end of the transaction. Only applied on
+	// postgres, sqlite serializes all writing transactions anyway.
+	ForUpdate bool
+}
+
+func buildSelectWhereQueryWithOptions[T any](q *Querier, where string, opts SelectOptions) (string, error) {
+	query, err := BuildSelectWhereQuery[T](where)
+	if err != nil {
+		return "", err
+	}
+	if len(opts.OrderBy) != 0 {
+		dbFields, _ := GetStructDBFields[T]()
+		var orderBy []string
+		for _, s := range opts.OrderBy {
+			df, ok := dbFields[s.Field]
+			if !ok {
+				return "", fmt.Errorf("field %s not found", s.Field)
+			}
+			dir := "asc"
+			if s.Desc {
+				dir = "desc"
+			}
+			orderBy = append(orderBy, fmt.Sprintf("%s %s", df.SelectName, dir))
+		}
+		query += "\norder by " + strings.Join(orderBy, ", ")
+	}
+	if opts.Limit > 0 {
+		query += fmt.Sprintf("\nlimit %d", opts.Limit)
+	}
+	if opts.ForUpdate {
+		switch q.E.DriverName() {
+		case "pgx", "postgres":
+			query += fmt.Sprintf("\nfor update of \"%s\"", GetTableName[T]())
+		}
+	}
+	return query, nil
+}
+
 func GetOne[T any](q *Querier, byFields map[string]any) (*T, error) {
 	where, args, err := BuildWhere[T](byFields)
 	if err != nil {
@@ -353,6 +408,21 @@ func GetOneWhere[T any](q *Querier, where string, args map[string]any) (*T, erro
 	return &ret, nil
 }
 
+func GetOneWhereWithOptions[T any](q *Querier, where string, args map[string]any, opts SelectOptions) (*T, error) {
+	query, err := buildSelectWhereQueryWithOptions[T](q, where, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret T
+	err = q.GetNamed(&ret, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
 func GetMany[T any](q *Querier, byFields map[string]any) ([]T, error) {
 	where, args, err := BuildWhere[T](byFields)
 	if err != nil {
@@ -376,6 +446,21 @@ func GetManyWhere[T any](q *Querier, where string, args map[string]any) ([]T, er
 	return ret, nil
 }
 
+func GetManyWhereWithOptions[T any](q *Querier, where string, args map[string]any, opts SelectOptions) ([]T, error) {
+	query, err := buildSelectWhereQueryWithOptions[T](q, where, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []T
+	err = q.SelectNamed(&ret, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
 func DeleteOneByStruct[T HasId](q *Querier, v T) error {
 	return DeleteOneById[T](q, v.GetId())
 }
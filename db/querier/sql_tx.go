@@ -0,0 +1,65 @@
+package querier
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SqlTx wraps a plain *sql.Tx (e.g. one created by a migration library) so that it can be used by a Querier.
+// sqlx only allows creating transactions with a driver name via Beginx, so SqlTx keeps the driver name itself
+// and implements sqlx.ExtContext.
+type SqlTx struct {
+	Tx *sql.Tx
+
+	driverName string
+	// x is only used to create sqlx rows with the mapper of the db, its driver name is not set
+	x *sqlx.Tx
+}
+
+var _ sqlx.ExtContext = &SqlTx{}
+
+func WrapSqlTx(db *sqlx.DB, tx *sql.Tx) *SqlTx {
+	return &SqlTx{
+		Tx:         tx,
+		driverName: db.DriverName(),
+		x:          &sqlx.Tx{Tx: tx, Mapper: db.Mapper},
+	}
+}
+
+func (t *SqlTx) DriverName() string {
+	return t.driverName
+}
+
+func (t *SqlTx) Rebind(query string) string {
+	return sqlx.Rebind(sqlx.BindType(t.driverName), query)
+}
+
+func (t *SqlTx) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
+	return sqlx.BindNamed(sqlx.BindType(t.driverName), query, arg)
+}
+
+func (t *SqlTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.QueryContext(ctx, query, args...)
+}
+
+func (t *SqlTx) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return t.x.QueryxContext(ctx, query, args...)
+}
+
+func (t *SqlTx) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	return t.x.QueryRowxContext(ctx, query, args...)
+}
+
+func (t *SqlTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, query, args...)
+}
+
+func NewQuerierFromSqlTx(ctx context.Context, db *sqlx.DB, tx *sql.Tx) *Querier {
+	return &Querier{
+		Ctx: ctx,
+		DB:  db,
+		E:   WrapSqlTx(db, tx),
+	}
+}
@@ -18,8 +18,12 @@ func joinPrefix(a string, b string) string {
 type StructDBField struct {
 	SelectName  string
 	FieldName   string
+	TableName   string
+	ColumnName  string
 	StructField reflect.StructField
 	Path        []int
+	// Join is set when the field belongs to a joined struct
+	Join *StructJoin
 }
 
 func GetStructValueByPath(v any, path []int) reflect.Value {
@@ -61,7 +65,7 @@ func GetStructDBFields[T any]() (map[string]StructDBField, []StructJoin) {
 	e2 := e.(*structDBFieldsCacheEntry)
 	e2.Once.Do(func() {
 		e2.fields = map[string]StructDBField{}
-		getStructDBFields2(t, GetTableName2(t), nil, "", e2.fields, &e2.joins)
+		getStructDBFields2(t, GetTableName2(t), nil, nil, "", e2.fields, &e2.joins)
 	})
 	return e2.fields, e2.joins
 }
@@ -98,7 +102,7 @@ func dupPath(p []int, extra int) []int {
 	return pathCopy
 }
 
-func getStructDBFields2(t reflect.Type, fromTableName string, path []int,
+func getStructDBFields2(t reflect.Type, fromTableName string, join *StructJoin, path []int,
 	fieldPrefix string,
 	retFields map[string]StructDBField, joins *[]StructJoin) {
 	if t.Kind() == reflect.Pointer {
@@ -113,12 +117,12 @@ func getStructDBFields2(t reflect.Type, fromTableName string, path []int,
 		if f.Tag.Get("join") == "true" {
 			join := getStructJoinInfo(t, f)
 			*joins = append(*joins, join)
-			getStructDBFields2(f.Type, join.RightTableName, path,
+			getStructDBFields2(f.Type, join.RightTableName, &join, path,
 				joinPrefix(fieldPrefix, util.ToSnakeCase(f.Name)),
 				retFields, joins)
 			continue
 		} else if f.Anonymous {
-			getStructDBFields2(f.Type, fromTableName, path, fieldPrefix, retFields, joins)
+			getStructDBFields2(f.Type, fromTableName, join, path, fieldPrefix, retFields, joins)
 			continue
 		}
 		dbFieldName := f.Tag.Get("db")
@@ -131,8 +135,11 @@ func getStructDBFields2(t reflect.Type, fromTableName string, path []int,
 		retFields[fieldName] = StructDBField{
 			SelectName:  selectName,
 			FieldName:   fieldName,
+			TableName:   fromTableName,
+			ColumnName:  dbFieldName,
 			StructField: f,
 			Path:        dupPath(path, 0),
+			Join:        join,
 		}
 	}
 }
@@ -0,0 +1,91 @@
+package querier
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type TxOptions struct {
+	ReadOnly  bool
+	Isolation sql.IsolationLevel
+
+	// StatementTimeout and LockTimeout are applied via "set local" and thus only last for the transaction.
+	// Only supported on postgres, ignored on sqlite.
+	StatementTimeout time.Duration
+	LockTimeout      time.Duration
+}
+
+// ParseIsolationLevel parses isolation level names like "serializable" or "repeatable read"
+func ParseIsolationLevel(s string) (sql.IsolationLevel, error) {
+	for l := sql.LevelDefault; l <= sql.LevelLinearizable; l++ {
+		if s == l.String() || s == sqlIsolationLevelName(l) {
+			return l, nil
+		}
+	}
+	return sql.LevelDefault, fmt.Errorf("unknown isolation level %s", s)
+}
+
+// sqlIsolationLevelName returns the lower case name used in SQL, e.g. "repeatable read"
+func sqlIsolationLevelName(l sql.IsolationLevel) string {
+	switch l {
+	case sql.LevelDefault:
+		return "default"
+	case sql.LevelReadUncommitted:
+		return "read uncommitted"
+	case sql.LevelReadCommitted:
+		return "read committed"
+	case sql.LevelWriteCommitted:
+		return "write committed"
+	case sql.LevelRepeatableRead:
+		return "repeatable read"
+	case sql.LevelSnapshot:
+		return "snapshot"
+	case sql.LevelSerializable:
+		return "serializable"
+	case sql.LevelLinearizable:
+		return "linearizable"
+	default:
+		return ""
+	}
+}
+
+// BeginTx begins a transaction with the given options. On sqlite, read-only and isolation levels are ignored by
+// the driver, as transactions are always serializable.
+func BeginTx(ctx context.Context, db *sqlx.DB, opts TxOptions) (*sqlx.Tx, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		Isolation: opts.Isolation,
+		ReadOnly:  opts.ReadOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch db.DriverName() {
+	case "pgx", "postgres":
+		var stmts []string
+		if opts.StatementTimeout > 0 {
+			stmts = append(stmts, fmt.Sprintf("set local statement_timeout = %d", timeoutMillis(opts.StatementTimeout)))
+		}
+		if opts.LockTimeout > 0 {
+			stmts = append(stmts, fmt.Sprintf("set local lock_timeout = %d", timeoutMillis(opts.LockTimeout)))
+		}
+		for _, s := range stmts {
+			_, err = tx.ExecContext(ctx, s)
+			if err != nil {
+				_ = tx.Rollback()
+				return nil, fmt.Errorf("failed to apply transaction options: %w", err)
+			}
+		}
+	}
+
+	return tx, nil
+}
+
+// timeoutMillis rounds up to at least 1ms, as 0 disables the timeout in postgres
+func timeoutMillis(d time.Duration) int64 {
+	return max(d.Milliseconds(), 1)
+}
@@ -0,0 +1,137 @@
+package querier
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TxHooks holds the callbacks registered via OnCommit and OnRollback for a transaction
+type TxHooks struct {
+	m          sync.Mutex
+	done       bool
+	onCommit   []func()
+	onRollback []func()
+}
+
+func NewTxHooks() *TxHooks {
+	return &TxHooks{}
+}
+
+// WithTx returns a context with the given transaction and hooks, as expected by GetQuerier, OnCommit and
+// OnRollback
+func WithTx(ctx context.Context, tx *sqlx.Tx, hooks *TxHooks) context.Context {
+	ctx = context.WithValue(ctx, "tx", tx)
+	return context.WithValue(ctx, "tx-hooks", hooks)
+}
+
+func GetTxHooks(c context.Context) *TxHooks {
+	hooks, _ := c.Value("tx-hooks").(*TxHooks)
+	return hooks
+}
+
+// OnCommit registers fn to be called after the transaction of the context was committed. If the context has no
+// transaction, fn is called immediately as there is nothing to wait for.
+func OnCommit(c context.Context, fn func()) {
+	hooks := GetTxHooks(c)
+	if hooks == nil || getTX(c, false) == nil {
+		runTxHook(c, "commit", fn)
+		return
+	}
+	hooks.m.Lock()
+	defer hooks.m.Unlock()
+	if hooks.done {
+		panic("transaction is already finished")
+	}
+	hooks.onCommit = append(hooks.onCommit, fn)
+}
+
+// OnRollback registers fn to be called after the transaction of the context was rolled back, including failed
+// commits. If the context has no transaction, fn is never called.
+func OnRollback(c context.Context, fn func()) {
+	hooks := GetTxHooks(c)
+	if hooks == nil || getTX(c, false) == nil {
+		return
+	}
+	hooks.m.Lock()
+	defer hooks.m.Unlock()
+	if hooks.done {
+		panic("transaction is already finished")
+	}
+	hooks.onRollback = append(hooks.onRollback, fn)
+}
+
+// RunCommitHooks calls the OnCommit callbacks in registration order. Hooks only run once, later calls of
+// RunCommitHooks or RunRollbackHooks do nothing.
+func (h *TxHooks) RunCommitHooks(c context.Context) {
+	h.run(c, "commit", true)
+}
+
+// RunRollbackHooks calls the OnRollback callbacks in registration order. Hooks only run once, later calls of
+// RunCommitHooks or RunRollbackHooks do nothing.
+func (h *TxHooks) RunRollbackHooks(c context.Context) {
+	h.run(c, "rollback", false)
+}
+
+func (h *TxHooks) run(c context.Context, kind string, committed bool) {
+	h.m.Lock()
+	if h.done {
+		h.m.Unlock()
+		return
+	}
+	h.done = true
+	fns := h.onRollback
+	if committed {
+		fns = h.onCommit
+	}
+	h.onCommit = nil
+	h.onRollback = nil
+	h.m.Unlock()
+
+	for _, fn := range fns {
+		runTxHook(c, kind, fn)
+	}
+}
+
+func runTxHook(c context.Context, kind string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.ErrorContext(c, fmt.Sprintf("panic in %s hook", kind), slog.Any("panic", r))
+		}
+	}()
+	fn()
+}
+
+// RunInTx runs fn in a new transaction, which is committed if fn returns nil and rolled back otherwise. The
+// context passed to fn contains the transaction, so that GetQuerier, OnCommit and OnRollback can be used.
+func RunInTx(c context.Context, db *sqlx.DB, opts TxOptions, fn func(c context.Context) error) error {
+	tx, err := BeginTx(c, db, opts)
+	if err != nil {
+		return err
+	}
+	hooks := NewTxHooks()
+
+	committed := false
+	defer func() {
+		if committed {
+			hooks.RunCommitHooks(c)
+			return
+		}
+		_ = tx.Rollback()
+		hooks.RunRollbackHooks(c)
+	}()
+
+	err = fn(WithTx(c, tx, hooks))
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
@@ -0,0 +1,115 @@
+package schema_verify
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/dboxed/dboxed-common/db/querier"
+)
+
+type dbColumn struct {
+	Name       string         `db:"name"`
+	Type       string         `db:"type"`
+	Nullable   bool           `db:"nullable"`
+	Default    sql.NullString `db:"dflt"`
+	PrimaryKey bool           `db:"pk"`
+}
+
+var queryTableColumns = map[string]string{
+	"pgx": `select c.column_name as name,
+       c.data_type as type,
+       c.is_nullable = 'YES' as nullable,
+       c.column_default as dflt,
+       exists(select 1
+              from information_schema.table_constraints tc
+              join information_schema.key_column_usage kcu
+                on kcu.constraint_name = tc.constraint_name and kcu.table_schema = tc.table_schema
+              where tc.constraint_type = 'PRIMARY KEY'
+                and tc.table_schema = c.table_schema
+                and tc.table_name = c.table_name
+                and kcu.column_name = c.column_name) as pk
+from information_schema.columns c
+where c.table_schema = current_schema() and c.table_name = :table_name
+order by c.ordinal_position`,
+	"sqlite3": `select name,
+       type,
+       "notnull" = 0 and pk = 0 as nullable,
+       dflt_value as dflt,
+       pk != 0 as pk
+from pragma_table_info(:table_name)
+order by cid`,
+}
+
+func getTableColumns(q *querier.Querier, table string) (map[string]dbColumn, error) {
+	var columns []dbColumn
+	err := q.SelectNamed(&columns, queryTableColumns, map[string]any{
+		"table_name": table,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect table %s: %w", table, err)
+	}
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	ret := map[string]dbColumn{}
+	for _, c := range columns {
+		ret[c.Name] = c
+	}
+	return ret, nil
+}
+
+type typeCategory string
+
+const (
+	typeInteger  typeCategory = "integer"
+	typeFloat    typeCategory = "float"
+	typeText     typeCategory = "text"
+	typeBool     typeCategory = "bool"
+	typeDatetime typeCategory = "datetime"
+	typeBlob     typeCategory = "blob"
+)
+
+// integerTypes are matched exactly, as a substring match on "int" would also catch interval or point
+var integerTypes = map[string]bool{
+	"int": true, "integer": true, "tinyint": true, "smallint": true, "mediumint": true, "bigint": true,
+	"int2": true, "int4": true, "int8": true, "unsigned big int": true,
+	"serial": true, "smallserial": true, "bigserial": true, "serial2": true, "serial4": true, "serial8": true,
+}
+
+func dbTypeCategory(t string) typeCategory {
+	t = strings.ToLower(strings.TrimSpace(t))
+	// strip type parameters, e.g. int(11) or varchar(255)
+	base := t
+	if i := strings.IndexByte(base, '('); i != -1 {
+		base = strings.TrimSpace(base[:i])
+	}
+	switch {
+	case strings.Contains(t, "timestamp"), strings.Contains(t, "datetime"), t == "date":
+		return typeDatetime
+	case strings.Contains(t, "bool"):
+		return typeBool
+	case integerTypes[base]:
+		return typeInteger
+	case strings.Contains(t, "char"), strings.Contains(t, "text"), strings.Contains(t, "clob"),
+		t == "uuid", t == "json", t == "jsonb":
+		return typeText
+	case strings.Contains(t, "blob"), t == "bytea":
+		return typeBlob
+	case strings.Contains(t, "real"), strings.Contains(t, "floa"), strings.Contains(t, "doub"),
+		strings.Contains(t, "numeric"), strings.Contains(t, "decimal"):
+		return typeFloat
+	default:
+		return ""
+	}
+}
+
+// compatibleTypes lists which database types a Go type category can be scanned from
+var compatibleTypes = map[typeCategory][]typeCategory{
+	typeInteger:  {typeInteger},
+	typeFloat:    {typeFloat, typeInteger},
+	typeText:     {typeText, typeDatetime},
+	typeBool:     {typeBool, typeInteger},
+	typeDatetime: {typeDatetime},
+	typeBlob:     {typeBlob, typeText},
+}
@@ -0,0 +1,234 @@
+package schema_verify
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/dboxed/dboxed-common/db/querier"
+)
+
+type IssueKind string
+
+const (
+	IssueMissingTable        IssueKind = "missing_table"
+	IssueMissingColumn       IssueKind = "missing_column"
+	IssueExtraColumn         IssueKind = "extra_column"
+	IssueTypeMismatch        IssueKind = "type_mismatch"
+	IssueNullabilityMismatch IssueKind = "nullability_mismatch"
+)
+
+type Issue struct {
+	Model   string    `json:"model"`
+	Table   string    `json:"table"`
+	Column  string    `json:"column,omitempty"`
+	Field   string    `json:"field,omitempty"`
+	Kind    IssueKind `json:"kind"`
+	Message string    `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s", i.Model, i.Message)
+}
+
+type model struct {
+	name   string
+	table  string
+	fields map[string]querier.StructDBField
+	joins  []querier.StructJoin
+}
+
+// Verifier compares registered model structs with the live database schema
+type Verifier struct {
+	models []model
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{}
+}
+
+func Register[T any](v *Verifier) {
+	t := reflect.TypeFor[T]()
+	fields, joins := querier.GetStructDBFields[T]()
+	v.models = append(v.models, model{
+		name:   t.String(),
+		table:  querier.GetTableName[T](),
+		fields: fields,
+		joins:  joins,
+	})
+}
+
+func (v *Verifier) Verify(q *querier.Querier) ([]Issue, error) {
+	tables := map[string]map[string]dbColumn{}
+	getColumns := func(table string) (map[string]dbColumn, error) {
+		if c, ok := tables[table]; ok {
+			return c, nil
+		}
+		c, err := getTableColumns(q, table)
+		if err != nil {
+			return nil, err
+		}
+		tables[table] = c
+		return c, nil
+	}
+
+	var issues []Issue
+	for _, m := range v.models {
+		mi, err := verifyModel(m, getColumns)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, mi...)
+	}
+	return issues, nil
+}
+
+func verifyModel(m model, getColumns func(table string) (map[string]dbColumn, error)) ([]Issue, error) {
+	var issues []Issue
+	addIssue := func(table string, column string, field string, kind IssueKind, msg string, args ...any) {
+		issues = append(issues, Issue{
+			Model:   m.name,
+			Table:   table,
+			Column:  column,
+			Field:   field,
+			Kind:    kind,
+			Message: fmt.Sprintf(msg, args...),
+		})
+	}
+
+	missingTables := map[string]bool{}
+	checkTable := func(table string) (map[string]dbColumn, error) {
+		columns, err := getColumns(table)
+		if err != nil {
+			return nil, err
+		}
+		if columns == nil && !missingTables[table] {
+			missingTables[table] = true
+			addIssue(table, "", "", IssueMissingTable, "table %s does not exist", table)
+		}
+		return columns, nil
+	}
+
+	for _, j := range m.joins {
+		for _, x := range []struct{ table, column string }{{j.LeftTableName, j.LeftIDField}, {j.RightTableName, j.RightIDField}} {
+			columns, err := checkTable(x.table)
+			if err != nil {
+				return nil, err
+			}
+			if columns == nil {
+				continue
+			}
+			if _, ok := columns[x.column]; !ok {
+				addIssue(x.table, x.column, "", IssueMissingColumn, "join column %s.%s does not exist", x.table, x.column)
+			}
+		}
+	}
+
+	usedColumns := map[string]bool{}
+	for _, fieldName := range sortedKeys(m.fields) {
+		f := m.fields[fieldName]
+		columns, err := checkTable(f.TableName)
+		if err != nil {
+			return nil, err
+		}
+		if columns == nil {
+			continue
+		}
+		if f.TableName == m.table {
+			usedColumns[f.ColumnName] = true
+		}
+
+		c, ok := columns[f.ColumnName]
+		if !ok {
+			addIssue(f.TableName, f.ColumnName, fieldName, IssueMissingColumn, "column %s.%s for field %s does not exist", f.TableName, f.ColumnName, fieldName)
+			continue
+		}
+
+		goCategory, goNullable := goTypeInfo(f.StructField.Type)
+		if f.Join != nil && f.Join.Type == "left" && !goNullable {
+			addIssue(f.TableName, f.ColumnName, fieldName, IssueNullabilityMismatch,
+				"field %s is on a left join and must be nullable (e.g. querier.NullForJoin)", fieldName)
+		} else if c.Nullable && !goNullable {
+			addIssue(f.TableName, f.ColumnName, fieldName, IssueNullabilityMismatch,
+				"column %s.%s is nullable but field %s is not", f.TableName, f.ColumnName, fieldName)
+		}
+
+		dbCategory := dbTypeCategory(c.Type)
+		if goCategory != "" && dbCategory != "" && !slices.Contains(compatibleTypes[goCategory], dbCategory) {
+			addIssue(f.TableName, f.ColumnName, fieldName, IssueTypeMismatch,
+				"column %s.%s has type %s which is incompatible with field %s of type %s",
+				f.TableName, f.ColumnName, c.Type, fieldName, f.StructField.Type.String())
+		}
+	}
+
+	columns, err := getColumns(m.table)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sortedKeys(columns) {
+		c := columns[name]
+		if usedColumns[name] || c.Nullable || c.Default.Valid || c.PrimaryKey {
+			continue
+		}
+		addIssue(m.table, name, "", IssueExtraColumn,
+			"column %s.%s is not null without default but has no field in the model", m.table, name)
+	}
+
+	return issues, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+var (
+	timeType    = reflect.TypeFor[time.Time]()
+	scannerType = reflect.TypeFor[sql.Scanner]()
+)
+
+// goTypeInfo returns the type category of a Go field type and whether it can hold NULL
+func goTypeInfo(t reflect.Type) (typeCategory, bool) {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		nullable = true
+		t = t.Elem()
+	}
+
+	// sql.Null[T], sql.NullString, querier.NullForJoin[T], ...
+	if t.Kind() == reflect.Struct && t != timeType && t.NumField() == 2 && t.Field(1).Name == "Valid" {
+		nullable = true
+		t = t.Field(0).Type
+	}
+
+	if t == timeType {
+		return typeDatetime, nullable
+	}
+	if reflect.PointerTo(t).Implements(scannerType) {
+		// custom types can scan anything
+		return "", nullable
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return typeInteger, nullable
+	case reflect.Float32, reflect.Float64:
+		return typeFloat, nullable
+	case reflect.String:
+		return typeText, nullable
+	case reflect.Bool:
+		return typeBool, nullable
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return typeBlob, true
+		}
+	}
+	return "", nullable
+}
@@ -0,0 +1,129 @@
+package schematemplates
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/dboxed/dboxed-common/util"
+)
+
+// ChecksumFile is written next to the rendered schemas and contains a checksum over all rendered files
+const ChecksumFile = "schemas.sha256"
+
+// driverDbTypes maps the canonical driver names to db types, RenderMigrations renders one schema set per entry
+var driverDbTypes = map[string]string{
+	"pgx":     "postgres",
+	"sqlite3": "sqlite",
+}
+
+// DbTypeForDriver accepts the same driver names as the migrator
+func DbTypeForDriver(driverName string) (string, error) {
+	switch driverName {
+	case "pgx", "postgres":
+		return "postgres", nil
+	case "sqlite3", "sqlite":
+		return "sqlite", nil
+	default:
+		return "", fmt.Errorf("no schema db type for driver %s", driverName)
+	}
+}
+
+func computeChecksum(m map[string]string) string {
+	var sb strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		sb.WriteString(k)
+		sb.WriteString("\n")
+		sb.WriteString(util.Sha256Sum([]byte(m[k])))
+		sb.WriteString("\n")
+	}
+	return util.Sha256Sum([]byte(sb.String()))
+}
+
+// RenderSchemasFS renders the templates into an in-memory fs.FS, including the checksum file
+func RenderSchemasFS(sourceFs fs.FS, dbType string) (fs.FS, error) {
+	m, err := renderSchemas(sourceFs, dbType)
+	if err != nil {
+		return nil, err
+	}
+	ret := memFS{}
+	for k, v := range m {
+		ret[k] = []byte(v)
+	}
+	ret[ChecksumFile] = []byte(computeChecksum(m) + "\n")
+	return ret, nil
+}
+
+// RenderMigrations renders the templates for all supported drivers. The result is keyed by driver name,
+// so it can be passed to the migrator directly.
+func RenderMigrations(sourceFs fs.FS) (map[string]fs.FS, error) {
+	ret := map[string]fs.FS{}
+	for driverName, dbType := range driverDbTypes {
+		rendered, err := RenderSchemasFS(sourceFs, dbType)
+		if err != nil {
+			return nil, fmt.Errorf("rendering schemas for %s failed: %w", dbType, err)
+		}
+		ret[driverName] = rendered
+	}
+	return ret, nil
+}
+
+func readSchemaFiles(fsys fs.FS) (map[string]string, error) {
+	m := map[string]string{}
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".sql") {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, f.Name())
+		if err != nil {
+			return nil, err
+		}
+		m[f.Name()] = string(b)
+	}
+	return m, nil
+}
+
+// CheckDrift verifies that previously generated schemas match the freshly rendered ones. If the generated
+// schemas contain a checksum file, it is also verified that they were not modified after rendering.
+func CheckDrift(rendered fs.FS, generated fs.FS) error {
+	renderedFiles, err := readSchemaFiles(rendered)
+	if err != nil {
+		return err
+	}
+	generatedFiles, err := readSchemaFiles(generated)
+	if err != nil {
+		return err
+	}
+	generatedChecksum := computeChecksum(generatedFiles)
+
+	b, err := fs.ReadFile(generated, ChecksumFile)
+	if err == nil && strings.TrimSpace(string(b)) != generatedChecksum {
+		return fmt.Errorf("generated schemas were modified after rendering: checksum mismatch")
+	}
+
+	if computeChecksum(renderedFiles) == generatedChecksum {
+		return nil
+	}
+
+	var diffs []string
+	for k, v := range renderedFiles {
+		if g, ok := generatedFiles[k]; !ok {
+			diffs = append(diffs, k+" (not generated)")
+		} else if g != v {
+			diffs = append(diffs, k+" (changed)")
+		}
+	}
+	for k := range generatedFiles {
+		if _, ok := renderedFiles[k]; !ok {
+			diffs = append(diffs, k+" (no template)")
+		}
+	}
+	slices.Sort(diffs)
+	return fmt.Errorf("generated schemas drifted from templates: %s", strings.Join(diffs, ", "))
+}
@@ -0,0 +1,75 @@
+package schematemplates
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+func buildFuncMap(dbType string) template.FuncMap {
+	return template.FuncMap{
+		"ifPostgres": func(s string) string {
+			return ifDbType(dbType, "postgres", s)
+		},
+		"ifSqlite": func(s string) string {
+			return ifDbType(dbType, "sqlite", s)
+		},
+		"softDeleteColumns": softDeleteColumns,
+		"timestampColumns":  timestampColumns,
+		"fk":                fk,
+		"index":             index,
+		"uniqueLive":        uniqueLive,
+	}
+}
+
+func ifDbType(dbType string, want string, s string) string {
+	if dbType != want {
+		return ""
+	}
+	return s
+}
+
+// the following functions may return TYPES_* placeholders, as these are replaced after template execution
+
+func softDeleteColumns() string {
+	return `deleted_at TYPES_DATETIME,
+    finalizers TYPES_TEXT not null default '{}'`
+}
+
+func timestampColumns() string {
+	return `created_at TYPES_DATETIME not null TYPES_DEFAULT_CURRENT_TIMESTAMP,
+    updated_at TYPES_DATETIME not null TYPES_DEFAULT_CURRENT_TIMESTAMP`
+}
+
+// fk renders a foreign key column type referencing the id of the given table, optionally followed by an
+// on delete action (e.g. "cascade")
+func fk(table string, onDelete ...string) (string, error) {
+	s := fmt.Sprintf(`TYPES_INT_FOREIGN_KEY references "%s" (id)`, table)
+	switch len(onDelete) {
+	case 0:
+	case 1:
+		s += " on delete " + onDelete[0]
+	default:
+		return "", fmt.Errorf("fk accepts at most one on delete action")
+	}
+	return s, nil
+}
+
+func index(table string, columns ...string) (string, error) {
+	if len(columns) == 0 {
+		return "", fmt.Errorf("index requires at least one column")
+	}
+	name := fmt.Sprintf("%s_%s_idx", table, strings.Join(columns, "_"))
+	return fmt.Sprintf(`create index %s on "%s" (%s);`,
+		name, table, strings.Join(columns, ", ")), nil
+}
+
+// uniqueLive renders a partial unique index which ignores soft-deleted rows
+func uniqueLive(table string, columns ...string) (string, error) {
+	if len(columns) == 0 {
+		return "", fmt.Errorf("uniqueLive requires at least one column")
+	}
+	name := fmt.Sprintf("%s_%s_live_key", table, strings.Join(columns, "_"))
+	return fmt.Sprintf(`create unique index %s on "%s" (%s) where deleted_at is null;`,
+		name, table, strings.Join(columns, ", ")), nil
+}
@@ -2,24 +2,59 @@ package schematemplates
 
 import (
 	"bytes"
+	"cmp"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 )
 
 var replacements = map[string]map[string]string{
 	"postgres": {
-		"TYPES_INT_PRIMARY_KEY": "bigserial primary key",
-		"TYPES_DATETIME":        "timestamptz",
+		"TYPES_INT_PRIMARY_KEY":           "bigserial primary key",
+		"TYPES_INT_FOREIGN_KEY":           "bigint",
+		"TYPES_DATETIME":                  "timestamptz",
+		"TYPES_BOOL":                      "boolean",
+		"TYPES_TEXT":                      "text",
+		"TYPES_BIGINT":                    "bigint",
+		"TYPES_BLOB":                      "bytea",
+		"TYPES_JSON":                      "jsonb",
+		"TYPES_UUID":                      "uuid",
+		"TYPES_DECIMAL":                   "numeric",
+		"TYPES_DEFAULT_CURRENT_TIMESTAMP": "default current_timestamp",
 	},
 	"sqlite": {
-		"TYPES_INT_PRIMARY_KEY": "integer primary key autoincrement",
-		"TYPES_DATETIME":        "datetime",
+		"TYPES_INT_PRIMARY_KEY":           "integer primary key autoincrement",
+		"TYPES_INT_FOREIGN_KEY":           "integer",
+		"TYPES_DATETIME":                  "datetime",
+		"TYPES_BOOL":                      "boolean",
+		"TYPES_TEXT":                      "text",
+		"TYPES_BIGINT":                    "integer",
+		"TYPES_BLOB":                      "blob",
+		"TYPES_JSON":                      "text",
+		"TYPES_UUID":                      "text",
+		"TYPES_DECIMAL":                   "numeric",
+		"TYPES_DEFAULT_CURRENT_TIMESTAMP": "default current_timestamp",
 	},
 }
 
+// replaceTypes replaces longer placeholders first, so that no placeholder can clobber another one that it
+// is a prefix of
+func replaceTypes(s string, dbType string) string {
+	r := replacements[dbType]
+	keys := slices.Collect(maps.Keys(r))
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), cmp.Compare(a, b))
+	})
+	for _, k := range keys {
+		s = strings.ReplaceAll(s, k, r[k])
+	}
+	return s
+}
+
 func renderSchemas(sourceFs fs.FS, dbType string) (map[string]string, error) {
 	m := map[string]string{}
 
@@ -36,7 +71,7 @@ func renderSchemas(sourceFs fs.FS, dbType string) (map[string]string, error) {
 			return nil, err
 		}
 
-		t, err := template.New("").Parse(string(b))
+		t, err := template.New(f.Name()).Funcs(buildFuncMap(dbType)).Parse(string(b))
 		if err != nil {
 			return nil, err
 		}
@@ -48,11 +83,7 @@ func renderSchemas(sourceFs fs.FS, dbType string) (map[string]string, error) {
 			return nil, err
 		}
 
-		s := buf.String()
-		for k, v := range replacements[dbType] {
-			s = strings.ReplaceAll(s, k, v)
-		}
-		m[f.Name()] = s
+		m[f.Name()] = replaceTypes(buf.String(), dbType)
 	}
 
 	return m, nil
@@ -76,5 +107,10 @@ func RenderSchemas(sourceFs fs.FS, targetDir string, dbType string) error {
 		}
 	}
 
+	err = os.WriteFile(filepath.Join(targetDir, ChecksumFile), []byte(computeChecksum(m)+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,113 @@
+package soft_delete
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dboxed/dboxed-common/db/querier"
+	"github.com/dboxed/dboxed-common/util"
+)
+
+var queryHasDBFinalizer = map[string]string{
+	"pgx":     `(finalizers::::jsonb -> :k::::text) is not null`,
+	"sqlite3": `json_type(finalizers, '$."' || :k || '"') is not null`,
+}
+
+func hasDBFinalizerCond(q *querier.Querier) (string, error) {
+	cond, ok := queryHasDBFinalizer[q.E.DriverName()]
+	if !ok {
+		return "", fmt.Errorf("unsupported database driver %s", q.E.DriverName())
+	}
+	return cond, nil
+}
+
+func buildBulkWhere[T any](byFields map[string]any) (string, map[string]any, error) {
+	where, args, err := querier.BuildWhere[T](byFields)
+	if err != nil {
+		return "", nil, err
+	}
+	if where == "" {
+		return "", nil, fmt.Errorf("refusing to run bulk operation without filter")
+	}
+	return where, args, nil
+}
+
+// SoftDeleteMany soft-deletes all not yet deleted rows matching byFields and returns their ids
+func SoftDeleteMany[T querier.HasId](q *querier.Querier, byFields map[string]any) ([]int64, error) {
+	where, args, err := buildBulkWhere[T](byFields)
+	if err != nil {
+		return nil, err
+	}
+
+	table := querier.GetTableName[T]()
+	query := fmt.Sprintf(`update "%s" set deleted_at = current_timestamp where %s and "%s".deleted_at is null returning id`,
+		table, where, table)
+
+	var ids []int64
+	err = q.SelectNamed(&ids, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordDeletionEvents[T](q, ids, DeletionEventSoftDeleted, "")
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// AddFinalizerMany adds the finalizer to all rows matching byFields which don't have it yet and returns
+// the ids of the modified rows
+func AddFinalizerMany[T IsSoftDelete](q *querier.Querier, byFields map[string]any, finalizer string, f Finalizer) ([]int64, error) {
+	where, args, err := buildBulkWhere[T](byFields)
+	if err != nil {
+		return nil, err
+	}
+	hasFinalizer, err := hasDBFinalizerCond(q)
+	if err != nil {
+		return nil, err
+	}
+	where = fmt.Sprintf("%s and not %s", where, hasFinalizer)
+
+	if f.AddedAt == nil {
+		f.AddedAt = util.Ptr(time.Now().UTC())
+	}
+
+	rows, err := updateDBFinalizers[T](q, where, args, finalizer, &f)
+	if err != nil {
+		return nil, err
+	}
+	return recordBulkFinalizerEvents[T](q, rows, DeletionEventFinalizerAdded, finalizer)
+}
+
+// RemoveFinalizerMany removes the finalizer from all rows matching byFields and returns the ids of the
+// modified rows
+func RemoveFinalizerMany[T IsSoftDelete](q *querier.Querier, byFields map[string]any, finalizer string) ([]int64, error) {
+	where, args, err := buildBulkWhere[T](byFields)
+	if err != nil {
+		return nil, err
+	}
+	hasFinalizer, err := hasDBFinalizerCond(q)
+	if err != nil {
+		return nil, err
+	}
+	where = fmt.Sprintf("%s and %s", where, hasFinalizer)
+
+	rows, err := updateDBFinalizers[T](q, where, args, finalizer, nil)
+	if err != nil {
+		return nil, err
+	}
+	return recordBulkFinalizerEvents[T](q, rows, DeletionEventFinalizerRemoved, finalizer)
+}
+
+func recordBulkFinalizerEvents[T any](q *querier.Querier, rows []finalizersRow, eventType DeletionEventType, finalizer string) ([]int64, error) {
+	ids := make([]int64, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.Id)
+	}
+	err := recordDeletionEvents[T](q, ids, eventType, finalizer)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,135 @@
+package soft_delete
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dboxed/dboxed-common/db/querier"
+)
+
+type DeletionEventType string
+
+const (
+	DeletionEventSoftDeleted      DeletionEventType = "soft_deleted"
+	DeletionEventFinalizerAdded   DeletionEventType = "finalizer_added"
+	DeletionEventFinalizerRemoved DeletionEventType = "finalizer_removed"
+	DeletionEventPurged           DeletionEventType = "purged"
+	DeletionEventRestored         DeletionEventType = "restored"
+)
+
+// DeletionEvent is a row in the append-only deletion event table. The table is expected to look like this:
+//
+//	create table deletion_event (
+//	    id         TYPES_INT_PRIMARY_KEY,
+//	    created_at TYPES_DATETIME not null default current_timestamp,
+//	    table_name text   not null,
+//	    row_id     bigint not null,
+//	    event_type text   not null,
+//	    finalizer  text,
+//	    actor      text
+//	);
+//	create index deletion_event_row on deletion_event (table_name, row_id);
+type DeletionEvent struct {
+	ID        int64     `db:"id" omitCreate:"true"`
+	CreatedAt time.Time `db:"created_at" omitCreate:"true"`
+
+	Table     string            `db:"table_name"`
+	RowId     int64             `db:"row_id"`
+	EventType DeletionEventType `db:"event_type"`
+	Finalizer sql.NullString    `db:"finalizer"`
+	Actor     sql.NullString    `db:"actor"`
+}
+
+func (v *DeletionEvent) GetTableName() string {
+	return getDeletionEventsTable()
+}
+
+// deletionEventsTable is set once by EnableDeletionEvents and read concurrently afterwards
+var deletionEventsTable atomic.Pointer[string]
+
+// EnableDeletionEvents enables writing of deletion events into the given table. It is meant to be called
+// once during initialization, before any soft-delete operation happens. Enabling a different table later
+// panics.
+func EnableDeletionEvents(table string) {
+	if !deletionEventsTable.CompareAndSwap(nil, &table) && *deletionEventsTable.Load() != table {
+		panic(fmt.Sprintf("deletion events are already enabled for table %s", *deletionEventsTable.Load()))
+	}
+}
+
+func getDeletionEventsTable() string {
+	table := deletionEventsTable.Load()
+	if table == nil {
+		return ""
+	}
+	return *table
+}
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, "actor", actor)
+}
+
+func GetActor(ctx context.Context) *string {
+	actor, ok := ctx.Value("actor").(string)
+	if !ok {
+		return nil
+	}
+	return &actor
+}
+
+func recordDeletionEvent[T any](q *querier.Querier, id int64, eventType DeletionEventType, finalizer string) error {
+	return recordDeletionEvents[T](q, []int64{id}, eventType, finalizer)
+}
+
+// deletionEventsBatchSize limits the number of rows per insert of recordDeletionEvents
+const deletionEventsBatchSize = 500
+
+// recordDeletionEvents records the same event for all ids, with one multi-row insert per batch
+func recordDeletionEvents[T any](q *querier.Querier, ids []int64, eventType DeletionEventType, finalizer string) error {
+	eventsTable := getDeletionEventsTable()
+	if eventsTable == "" || len(ids) == 0 {
+		return nil
+	}
+
+	args := map[string]any{
+		"table_name": querier.GetTableName[T](),
+		"event_type": string(eventType),
+		"finalizer":  sql.NullString{String: finalizer, Valid: finalizer != ""},
+		"actor":      sql.NullString{},
+	}
+	if actor := GetActor(q.Ctx); actor != nil {
+		args["actor"] = sql.NullString{String: *actor, Valid: true}
+	}
+
+	for batch := range slices.Chunk(ids, deletionEventsBatchSize) {
+		values := make([]string, 0, len(batch))
+		for _, id := range batch {
+			values = append(values, fmt.Sprintf("(:table_name, %d, :event_type, :finalizer, :actor)", id))
+		}
+		query := fmt.Sprintf(`insert into "%s" (table_name, row_id, event_type, finalizer, actor) values %s`,
+			eventsTable, strings.Join(values, ", "))
+		_, err := q.ExecNamed(query, args)
+		if err != nil {
+			return fmt.Errorf("failed to record deletion events: %w", err)
+		}
+	}
+	return nil
+}
+
+func GetDeletionEvents[T any](q *querier.Querier, id int64) ([]DeletionEvent, error) {
+	eventsTable := getDeletionEventsTable()
+	if eventsTable == "" {
+		return nil, fmt.Errorf("deletion events are not enabled")
+	}
+	return querier.GetManyWhere[DeletionEvent](q,
+		fmt.Sprintf(`"%s".table_name = :table_name and "%s".row_id = :row_id order by "%s".id`,
+			eventsTable, eventsTable, eventsTable),
+		map[string]any{
+			"table_name": querier.GetTableName[T](),
+			"row_id":     id,
+		})
+}
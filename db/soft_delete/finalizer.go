@@ -0,0 +1,65 @@
+package soft_delete
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+type Finalizer struct {
+	AddedAt   *time.Time      `json:"added_at,omitempty"`
+	Owner     string          `json:"owner,omitempty"`
+	Attempts  int             `json:"attempts,omitempty"`
+	LastError string          `json:"last_error,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+type finalizerJson Finalizer
+
+// UnmarshalJSON also accepts the legacy boolean form ("k": true) of finalizer entries
+func (f *Finalizer) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("true")) || bytes.Equal(b, []byte("null")) {
+		*f = Finalizer{}
+		return nil
+	}
+	var tmp finalizerJson
+	err := json.Unmarshal(b, &tmp)
+	if err != nil {
+		return err
+	}
+	*f = Finalizer(tmp)
+	return nil
+}
+
+func parseFinalizers(s string) map[string]Finalizer {
+	if s == "{}" || s == "" {
+		return nil
+	}
+	var m map[string]Finalizer
+	err := json.Unmarshal([]byte(s), &m)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func compareFinalizers(m map[string]Finalizer, a string, b string) int {
+	fa := m[a]
+	fb := m[b]
+	if fa.AddedAt != nil && fb.AddedAt != nil {
+		if c := fa.AddedAt.Compare(*fb.AddedAt); c != 0 {
+			return c
+		}
+	} else if fa.AddedAt == nil && fb.AddedAt != nil {
+		return -1
+	} else if fa.AddedAt != nil && fb.AddedAt == nil {
+		return 1
+	}
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,259 @@
+package soft_delete
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dboxed/dboxed-common/db/querier"
+	"github.com/dboxed/dboxed-common/util"
+)
+
+type RetentionPolicy struct {
+	// MinAge is the minimum time after deleted_at before a row without finalizers is purged
+	MinAge time.Duration
+	// MaxAge is the time after deleted_at after which a row is purged even if finalizers are still present.
+	// Zero means that rows with finalizers are never purged.
+	MaxAge time.Duration
+
+	// ArchiveTable is the name of a table with the same columns as the source table. Rows are copied into
+	// it before they are deleted.
+	ArchiveTable string
+	// ArchiveDir is a local directory into which purged rows are written as gzip compressed JSON lines. The
+	// file is written and synced before the rows are deleted, so that a failed write aborts the purge. It is
+	// renamed to its final name once the delete is committed and removed on rollback, so in a transaction the
+	// querier's context must carry transaction hooks (see querier.RunInTx).
+	ArchiveDir string
+
+	// BatchSize limits the number of rows purged per table and run. Defaults to 1000.
+	BatchSize int
+}
+
+type RetentionReport struct {
+	Table       string  `json:"table"`
+	DryRun      bool    `json:"dry_run"`
+	Ids         []int64 `json:"ids"`
+	ArchiveFile string  `json:"archive_file,omitempty"`
+}
+
+type RetentionJob struct {
+	entries []retentionEntry
+}
+
+type retentionEntry struct {
+	table  string
+	policy RetentionPolicy
+	purge  func(q *querier.Querier, now time.Time, dryRun bool) (*RetentionReport, error)
+}
+
+func NewRetentionJob() *RetentionJob {
+	return &RetentionJob{}
+}
+
+func AddRetentionPolicy[T IsSoftDelete](j *RetentionJob, policy RetentionPolicy) {
+	j.entries = append(j.entries, retentionEntry{
+		table:  querier.GetTableName[T](),
+		policy: policy,
+		purge: func(q *querier.Querier, now time.Time, dryRun bool) (*RetentionReport, error) {
+			return PurgeExpired[T](q, policy, now, dryRun)
+		},
+	})
+}
+
+// Run purges expired rows of all registered types. In dry-run mode, nothing is archived or deleted and
+// the reports only list the rows that would be purged.
+func (j *RetentionJob) Run(q *querier.Querier, dryRun bool) ([]RetentionReport, error) {
+	now := time.Now().UTC()
+	var ret []RetentionReport
+	for _, e := range j.entries {
+		r, err := e.purge(q, now, dryRun)
+		if err != nil {
+			return ret, fmt.Errorf("purging expired rows from %s failed: %w", e.table, err)
+		}
+		ret = append(ret, *r)
+	}
+	return ret, nil
+}
+
+func PurgeExpired[T IsSoftDelete](q *querier.Querier, policy RetentionPolicy, now time.Time, dryRun bool) (*RetentionReport, error) {
+	table := querier.GetTableName[T]()
+	dbFields, _ := querier.GetStructDBFields[T]()
+
+	batchSize := policy.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	deletedAt := dbFields["deleted_at"].SelectName
+	finalizers := dbFields["finalizers"].SelectName
+	where := fmt.Sprintf("%s is not null and %s < :min_cutoff", deletedAt, deletedAt)
+	args := map[string]any{
+		"min_cutoff": now.Add(-policy.MinAge),
+	}
+	if policy.MaxAge != 0 {
+		where += fmt.Sprintf(" and (%s = '{}' or %s < :max_cutoff)", finalizers, deletedAt)
+		args["max_cutoff"] = now.Add(-policy.MaxAge)
+	} else {
+		where += fmt.Sprintf(" and %s = '{}'", finalizers)
+	}
+	rows, err := querier.GetManyWhereWithOptions[T](q, where, args, querier.SelectOptions{
+		OrderBy: []querier.SortField{{Field: "deleted_at"}},
+		Limit:   batchSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RetentionReport{
+		Table:  table,
+		DryRun: dryRun,
+		Ids:    []int64{},
+	}
+	for _, r := range rows {
+		report.Ids = append(report.Ids, r.GetId())
+	}
+	if dryRun || len(rows) == 0 {
+		return report, nil
+	}
+
+	idList := buildIdList(report.Ids)
+
+	if policy.ArchiveTable != "" {
+		var columns []string
+		for _, f := range dbFields {
+			if strings.Contains(f.FieldName, ".") {
+				continue
+			}
+			columns = append(columns, f.FieldName)
+		}
+		columnsStr := strings.Join(columns, ", ")
+		query := fmt.Sprintf(`insert into "%s" (%s) select %s from "%s" where id in (%s)`,
+			policy.ArchiveTable, columnsStr, columnsStr, table, idList)
+		_, err = q.ExecNamed(query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("archiving to table %s failed: %w", policy.ArchiveTable, err)
+		}
+	}
+
+	if policy.ArchiveDir != "" {
+		report.ArchiveFile = archiveFilePath(policy.ArchiveDir, table, now)
+		if q.InTx() && querier.GetTxHooks(q.Ctx) == nil {
+			return nil, fmt.Errorf("archiving to a directory in a transaction requires transaction hooks, see querier.RunInTx")
+		}
+		// the archive must be on disk before the rows are gone
+		err = writeArchiveFile(pendingArchiveFilePath(report.ArchiveFile), rows)
+		if err != nil {
+			return nil, err
+		}
+		if q.InTx() {
+			querier.OnCommit(q.Ctx, func() {
+				err := commitArchiveFile(report.ArchiveFile)
+				if err != nil {
+					slog.ErrorContext(q.Ctx, "committing archive file failed", slog.Any("error", err))
+				}
+			})
+			querier.OnRollback(q.Ctx, func() {
+				_ = os.Remove(pendingArchiveFilePath(report.ArchiveFile))
+			})
+		}
+	}
+
+	_, err = q.ExecNamed(fmt.Sprintf(`delete from "%s" where id in (%s)`, table, idList), nil)
+	if err != nil {
+		if policy.ArchiveDir != "" && !q.InTx() {
+			_ = os.Remove(pendingArchiveFilePath(report.ArchiveFile))
+		}
+		return nil, err
+	}
+	if policy.ArchiveDir != "" && !q.InTx() {
+		err = commitArchiveFile(report.ArchiveFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = recordDeletionEvents[T](q, report.Ids, DeletionEventPurged, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func buildIdList(ids []int64) string {
+	s := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s = append(s, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(s, ", ")
+}
+
+func archiveFilePath(dir string, table string, now time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%s.jsonl.gz", table, now.Format("20060102T150405.000000000Z")))
+}
+
+// pendingArchiveFilePath is the path the archive is written to before the delete is committed
+func pendingArchiveFilePath(path string) string {
+	return path + ".pending"
+}
+
+// writeArchiveFile writes and fsyncs the archive
+func writeArchiveFile[T any](path string, rows []T) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	for _, r := range rows {
+		sb.WriteString(util.MustJson(r))
+		sb.WriteString("\n")
+	}
+	b, err := util.CompressGzipString(sb.String())
+	if err != nil {
+		return err
+	}
+
+	err = writeSyncedFile(path, b)
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("writing archive file failed: %w", err)
+	}
+	return nil
+}
+
+func writeSyncedFile(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(b)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// commitArchiveFile renames the pending archive to its final name and syncs the directory, so that the rename
+// is durable
+func commitArchiveFile(path string) error {
+	err := os.Rename(pendingArchiveFilePath(path), path)
+	if err != nil {
+		return err
+	}
+	d, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -2,8 +2,8 @@ package soft_delete
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"maps"
 	"slices"
 	"strings"
 	"time"
@@ -20,6 +20,9 @@ type IsSoftDelete interface {
 	GetFinalizers() []string
 	SetFinalizers(finalizers []string)
 	HasFinalizer(k string) bool
+	GetFinalizer(k string) *Finalizer
+	GetFinalizerEntries() map[string]Finalizer
+	SetFinalizerEntries(finalizers map[string]Finalizer)
 
 	setFinalizersRaw(finalizers string)
 }
@@ -36,28 +39,51 @@ func (v *SoftDeleteFields) GetDeletedAt() *time.Time {
 	return &v.DeletedAt.Time
 }
 
+// GetFinalizers returns the finalizer keys ordered by the time they were added, with ties (and legacy
+// entries without timestamp) ordered by key
 func (v *SoftDeleteFields) GetFinalizers() []string {
-	if v.Finalizers == "{}" || v.Finalizers == "" {
+	m := parseFinalizers(v.Finalizers)
+	if len(m) == 0 {
 		return nil
 	}
-	var m map[string]any
-	err := json.Unmarshal([]byte(v.Finalizers), &m)
-	if err != nil {
-		panic(err)
-	}
-	ret := make([]string, 0, len(m))
-	for k := range m {
-		ret = append(ret, k)
-	}
+	ret := slices.Collect(maps.Keys(m))
+	slices.SortFunc(ret, func(a, b string) int {
+		return compareFinalizers(m, a, b)
+	})
 	return ret
 }
 
 func (v *SoftDeleteFields) SetFinalizers(finalizers []string) {
-	m := map[string]bool{}
+	old := parseFinalizers(v.Finalizers)
+	m := map[string]Finalizer{}
 	for _, x := range finalizers {
-		m[x] = true
+		m[x] = old[x]
+	}
+	v.SetFinalizerEntries(m)
+}
+
+func (v *SoftDeleteFields) GetFinalizerEntries() map[string]Finalizer {
+	m := parseFinalizers(v.Finalizers)
+	if m == nil {
+		m = map[string]Finalizer{}
+	}
+	return m
+}
+
+func (v *SoftDeleteFields) SetFinalizerEntries(finalizers map[string]Finalizer) {
+	if finalizers == nil {
+		finalizers = map[string]Finalizer{}
+	}
+	v.Finalizers = util.MustJson(finalizers)
+}
+
+func (v *SoftDeleteFields) GetFinalizer(k string) *Finalizer {
+	m := parseFinalizers(v.Finalizers)
+	f, ok := m[k]
+	if !ok {
+		return nil
 	}
-	v.Finalizers = util.MustJson(m)
+	return &f
 }
 
 func (v *SoftDeleteFields) setFinalizersRaw(finalizers string) {
@@ -65,13 +91,50 @@ func (v *SoftDeleteFields) setFinalizersRaw(finalizers string) {
 }
 
 func (v *SoftDeleteFields) HasFinalizer(k string) bool {
-	return slices.Contains(v.GetFinalizers(), k)
+	_, ok := parseFinalizers(v.Finalizers)[k]
+	return ok
 }
 
 func SoftDelete[T querier.HasId](q *querier.Querier, byFields map[string]any) error {
-	return querier.UpdateOneByFields[T](q, byFields, map[string]any{
-		"deleted_at": querier.RawSql("current_timestamp"),
+	return setDeletedAt[T](q, byFields, querier.RawSql("current_timestamp"), DeletionEventSoftDeleted)
+}
+
+func Restore[T querier.HasId](q *querier.Querier, byFields map[string]any) error {
+	return setDeletedAt[T](q, byFields, nil, DeletionEventRestored)
+}
+
+func setDeletedAt[T any](q *querier.Querier, byFields map[string]any, deletedAt any, eventType DeletionEventType) error {
+	if getDeletionEventsTable() == "" {
+		return querier.UpdateOneByFields[T](q, byFields, map[string]any{
+			"deleted_at": deletedAt,
+		})
+	}
+
+	// we need the id for the event log
+	where, args, err := querier.BuildWhere[T](byFields)
+	if err != nil {
+		return err
+	}
+	table := querier.GetTableName[T]()
+	var ids []int64
+	err = q.SelectNamed(&ids, fmt.Sprintf(`select "%s".id from "%s" where %s`, table, table, where), args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return sql.ErrNoRows
+	} else if len(ids) != 1 {
+		return fmt.Errorf("unexpected rows_affected")
+	}
+	id := ids[0]
+
+	err = querier.UpdateOneByFields[T](q, map[string]any{"id": id}, map[string]any{
+		"deleted_at": deletedAt,
 	})
+	if err != nil {
+		return err
+	}
+	return recordDeletionEvent[T](q, id, eventType, "")
 }
 
 func SoftDeleteWithConstraints[T querier.HasId](q *querier.Querier, byFields map[string]any) error {
@@ -100,42 +163,101 @@ func SoftDeleteWithConstraints[T querier.HasId](q *querier.Querier, byFields map
 
 var querySetDBFinalizers = map[string]string{
 	"pgx": `update @@table_name
-set    finalizers = jsonb_strip_nulls(jsonb_set(to_jsonb(finalizers::::json), '{@@k}', '@@nullOrTrue'))
-where id = :id
-returning finalizers`,
+set    finalizers = finalizers::::jsonb || jsonb_build_object(:k::::text, :value::::jsonb)
+where @@where
+returning id, finalizers`,
+	"sqlite3": `
+update @@table_name
+set    finalizers = json_set(finalizers, '$."' || :k || '"', json(:value))
+where @@where
+returning id, finalizers`,
+}
+
+var queryRemoveDBFinalizers = map[string]string{
+	"pgx": `update @@table_name
+set    finalizers = finalizers::::jsonb - :k::::text
+where @@where
+returning id, finalizers`,
 	"sqlite3": `
 update @@table_name
-set    finalizers = json_patch(finalizers, '{"@@k":: @@nullOrTrue}')
-where id = :id
-returning finalizers`,
+set    finalizers = json_remove(finalizers, '$."' || :k || '"')
+where @@where
+returning id, finalizers`,
+}
+
+type finalizersRow struct {
+	Id         int64  `db:"id"`
+	Finalizers string `db:"finalizers"`
 }
 
-func setDBFinalizers[T any](q *querier.Querier, id int64, k string, v bool) (string, error) {
-	nullOrTrue := "null"
-	if v {
-		nullOrTrue = "true"
+// setDBFinalizer atomically sets or removes (f == nil) a single finalizer key without touching other keys
+func setDBFinalizer[T any](q *querier.Querier, id int64, k string, f *Finalizer) (string, error) {
+	rows, err := updateDBFinalizers[T](q, "id = :id", map[string]any{"id": id}, k, f)
+	if err != nil {
+		return "", err
 	}
+	if len(rows) == 0 {
+		return "", sql.ErrNoRows
+	}
+	return rows[0].Finalizers, nil
+}
 
-	var newFinalizers string
-	err := q.GetNamed(&newFinalizers, querySetDBFinalizers, map[string]any{
-		"id":           id,
+func updateDBFinalizers[T any](q *querier.Querier, where string, whereArgs map[string]any, k string, f *Finalizer) ([]finalizersRow, error) {
+	query := querySetDBFinalizers
+	args := map[string]any{
 		"@@table_name": querier.GetTableName[T](),
-		"@@k":          k,
-		"@@nullOrTrue": nullOrTrue,
-	})
+		"@@where":      where,
+		"k":            k,
+	}
+	for ak, av := range whereArgs {
+		args[ak] = av
+	}
+	if f == nil {
+		query = queryRemoveDBFinalizers
+	} else {
+		args["value"] = util.MustJson(f)
+	}
+
+	var rows []finalizersRow
+	err := q.SelectNamed(&rows, query, args)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return newFinalizers, nil
+	return rows, nil
 }
 
 func AddFinalizer[T IsSoftDelete](q *querier.Querier, v T, finalizer string) error {
+	return AddFinalizerEntry(q, v, finalizer, Finalizer{})
+}
+
+// AddFinalizerEntry adds the finalizer with the given metadata. AddedAt is filled in if not set. If the
+// finalizer is already present, it is left untouched.
+func AddFinalizerEntry[T IsSoftDelete](q *querier.Querier, v T, finalizer string, f Finalizer) error {
 	if v.HasFinalizer(finalizer) {
 		return nil
 	}
+	if f.AddedAt == nil {
+		f.AddedAt = util.Ptr(time.Now().UTC())
+	}
 
-	newFinalizers, err := setDBFinalizers[T](q, v.GetId(), finalizer, true)
+	newFinalizers, err := setDBFinalizer[T](q, v.GetId(), finalizer, &f)
+	if err != nil {
+		return err
+	}
+
+	v.setFinalizersRaw(newFinalizers)
+
+	return recordDeletionEvent[T](q, v.GetId(), DeletionEventFinalizerAdded, finalizer)
+}
+
+// UpdateFinalizer replaces the metadata of an existing finalizer
+func UpdateFinalizer[T IsSoftDelete](q *querier.Querier, v T, finalizer string, f Finalizer) error {
+	if !v.HasFinalizer(finalizer) {
+		return fmt.Errorf("finalizer %s not found", finalizer)
+	}
+
+	newFinalizers, err := setDBFinalizer[T](q, v.GetId(), finalizer, &f)
 	if err != nil {
 		return err
 	}
@@ -145,17 +267,38 @@ func AddFinalizer[T IsSoftDelete](q *querier.Querier, v T, finalizer string) err
 	return nil
 }
 
+// RecordFinalizerAttempt increments the attempt counter of the finalizer and stores the last error (or
+// clears it if err is nil)
+func RecordFinalizerAttempt[T IsSoftDelete](q *querier.Querier, v T, finalizer string, err error) error {
+	f := v.GetFinalizer(finalizer)
+	if f == nil {
+		return fmt.Errorf("finalizer %s not found", finalizer)
+	}
+	f.Attempts++
+	f.LastError = ""
+	if err != nil {
+		f.LastError = err.Error()
+	}
+	return UpdateFinalizer(q, v, finalizer, *f)
+}
+
 func RemoveFinalizer[T IsSoftDelete](q *querier.Querier, v T, finalizer string) error {
 	if !v.HasFinalizer(finalizer) {
 		return nil
 	}
 
-	newFinalizers, err := setDBFinalizers[T](q, v.GetId(), finalizer, false)
+	newFinalizers, err := setDBFinalizer[T](q, v.GetId(), finalizer, nil)
 	if err != nil {
 		return err
 	}
 
 	v.setFinalizersRaw(newFinalizers)
 
-	return nil
+	return recordDeletionEvent[T](q, v.GetId(), DeletionEventFinalizerRemoved, finalizer)
+}
+
+// CreateOrUpdateLive creates or updates the row, using the partial unique index on the given columns which
+// ignores soft-deleted rows (see the uniqueLive schema template function) as conflict target
+func CreateOrUpdateLive[T any](q *querier.Querier, v *T, columns ...string) error {
+	return querier.CreateOrUpdateWhere(q, v, strings.Join(columns, ", "), "deleted_at is null")
 }
@@ -0,0 +1,459 @@
+package huma_utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dboxed/dboxed-common/db/querier"
+	"github.com/dboxed/dboxed-common/db/soft_delete"
+)
+
+type CRUDOp string
+
+const (
+	CRUDList   CRUDOp = "list"
+	CRUDGet    CRUDOp = "get"
+	CRUDCreate CRUDOp = "create"
+	CRUDUpdate CRUDOp = "update"
+	CRUDDelete CRUDOp = "delete"
+)
+
+var AllCRUDOps = []CRUDOp{CRUDList, CRUDGet, CRUDCreate, CRUDUpdate, CRUDDelete}
+
+type CRUDOptions[Model, CreateReq, UpdateReq, Resp any] struct {
+	// Path is the collection path, e.g. /v1/boxes. Item operations use Path + "/{id}".
+	Path string
+	// Name is the singular resource name, used for operation ids and summaries
+	Name string
+	// Plural is the plural resource name. Defaults to Name + "s".
+	Plural string
+	Tags   []string
+	// Ops are the operations to register. Defaults to AllCRUDOps.
+	Ops []CRUDOp
+	// Operation is called for every operation before it is registered, e.g. to add security or metadata
+	Operation func(op *huma.Operation)
+
+	// Authorize is called before every operation. m is nil for list and create. Return a huma.StatusError
+	// to deny the request.
+	Authorize func(ctx context.Context, op CRUDOp, m *Model) error
+	// Scope returns additional fields to filter by in list, get, update and delete, e.g. to restrict the
+	// resource to the current user
+	Scope func(ctx context.Context) (map[string]any, error)
+
+	// NewModel builds the model from the create request. Required for create.
+	NewModel func(ctx context.Context, req *CreateReq) (*Model, error)
+	// ApplyUpdate applies the update request to the model and returns the updated db fields. Required for
+	// update.
+	ApplyUpdate func(ctx context.Context, m *Model, req *UpdateReq) ([]string, error)
+	// ValidateCreate and ValidateUpdate are called before the create/update
+	ValidateCreate func(ctx context.Context, req *CreateReq) error
+	ValidateUpdate func(ctx context.Context, m *Model, req *UpdateReq) error
+
+	// ToResponse maps the model to the response. Required.
+	ToResponse func(ctx context.Context, m *Model) (*Resp, error)
+}
+
+type crudCreateInput[CreateReq any] struct {
+	Body CreateReq
+}
+
+type crudListInput[Model any] struct {
+	ListParams[Model]
+	ConditionalParams
+}
+
+type crudItemInput struct {
+	IdByPath
+	ConditionalParams
+}
+
+type crudUpdateInput[UpdateReq any] struct {
+	IdByPath
+	ConditionalParams
+	Body UpdateReq
+}
+
+// RegisterCRUD registers list, get, create, update and delete operations for Model, backed by the querier
+// generics. If Model embeds soft_delete.SoftDeleteFields, delete soft-deletes the row. Responses carry an ETag
+// (see ModelETag), which is checked against If-None-Match on get/list and If-Match on update/delete. Update and
+// delete lock the row, models implementing HasVersion need a version db field, which is incremented on every
+// update and checked on writes. List filters and sorting are limited to fields with a list tag, see ListParams.
+// *Model must implement querier.HasId, PModel is inferred.
+func RegisterCRUD[Model, CreateReq, UpdateReq, Resp any, PModel interface {
+	*Model
+	querier.HasId
+}](api huma.API, opts CRUDOptions[Model, CreateReq, UpdateReq, Resp]) {
+	if opts.Plural == "" {
+		opts.Plural = opts.Name + "s"
+	}
+	if opts.Ops == nil {
+		opts.Ops = AllCRUDOps
+	}
+	if opts.ToResponse == nil {
+		panic("ToResponse is required")
+	}
+	itemPath := opts.Path + "/{id}"
+
+	RegisterProblemModel[Model]()
+
+	register := func(op huma.Operation, crudOp CRUDOp, handler func(op *huma.Operation)) {
+		for _, x := range opts.Ops {
+			if x == crudOp {
+				op.Tags = opts.Tags
+				if opts.Operation != nil {
+					opts.Operation(&op)
+				}
+				handler(&op)
+				return
+			}
+		}
+	}
+
+	c := &crud[Model, CreateReq, UpdateReq, Resp]{
+		opts:       opts,
+		softDelete: soft_delete.SoftDelete[PModel],
+	}
+
+	register(huma.Operation{
+		OperationID: "list-" + opts.Plural,
+		Method:      http.MethodGet,
+		Path:        opts.Path,
+		Summary:     "List " + opts.Plural,
+	}, CRUDList, func(op *huma.Operation) {
+		ListParamsOperation[Model]()(op)
+		huma.Register(api, *op, c.list)
+	})
+	register(huma.Operation{
+		OperationID: "get-" + opts.Name,
+		Method:      http.MethodGet,
+		Path:        itemPath,
+		Summary:     "Get " + opts.Name,
+	}, CRUDGet, func(op *huma.Operation) {
+		huma.Register(api, *op, c.get)
+	})
+	register(huma.Operation{
+		OperationID:   "create-" + opts.Name,
+		Method:        http.MethodPost,
+		Path:          opts.Path,
+		Summary:       "Create " + opts.Name,
+		DefaultStatus: http.StatusCreated,
+	}, CRUDCreate, func(op *huma.Operation) {
+		if opts.NewModel == nil {
+			panic("NewModel is required for create")
+		}
+		huma.Register(api, *op, c.create)
+	})
+	register(huma.Operation{
+		OperationID: "update-" + opts.Name,
+		Method:      http.MethodPatch,
+		Path:        itemPath,
+		Summary:     "Update " + opts.Name,
+	}, CRUDUpdate, func(op *huma.Operation) {
+		if opts.ApplyUpdate == nil {
+			panic("ApplyUpdate is required for update")
+		}
+		huma.Register(api, *op, c.update)
+	})
+	register(huma.Operation{
+		OperationID:   "delete-" + opts.Name,
+		Method:        http.MethodDelete,
+		Path:          itemPath,
+		Summary:       "Delete " + opts.Name,
+		DefaultStatus: http.StatusNoContent,
+	}, CRUDDelete, func(op *huma.Operation) {
+		huma.Register(api, *op, c.delete)
+	})
+}
+
+// hasDeletedAt is implemented by models embedding soft_delete.SoftDeleteFields
+type hasDeletedAt interface {
+	GetDeletedAt() *time.Time
+}
+
+type crud[Model, CreateReq, UpdateReq, Resp any] struct {
+	opts CRUDOptions[Model, CreateReq, UpdateReq, Resp]
+	// softDelete is soft_delete.SoftDelete instantiated with *Model, which is only known to implement
+	// querier.HasId in RegisterCRUD
+	softDelete func(q *querier.Querier, byFields map[string]any) error
+}
+
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) authorize(ctx context.Context, op CRUDOp, m *Model) error {
+	if c.opts.Authorize == nil {
+		return nil
+	}
+	return c.opts.Authorize(ctx, op, m)
+}
+
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) byFields(ctx context.Context, id *int64) (map[string]any, error) {
+	ret := map[string]any{}
+	if c.opts.Scope != nil {
+		scope, err := c.opts.Scope(ctx)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(ret, scope)
+	}
+	if id != nil {
+		ret["id"] = *id
+	}
+	return ret, nil
+}
+
+// getModel returns the model and the fields identifying it. forUpdate locks the row until the end of the
+// transaction, so that the ETag check and the following write can't race with concurrent writes.
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) getModel(ctx context.Context, q *querier.Querier, id int64, forUpdate bool) (*Model, map[string]any, error) {
+	byFields, err := c.byFields(ctx, &id)
+	if err != nil {
+		return nil, nil, err
+	}
+	where, args, err := querier.BuildWhere[Model](byFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := querier.GetOneWhereWithOptions[Model](q, where, args, querier.SelectOptions{ForUpdate: forUpdate})
+	if err != nil {
+		if querier.IsSqlNotFoundError(err) {
+			return nil, nil, huma.Error404NotFound(fmt.Sprintf("%s not found", c.opts.Name))
+		}
+		return nil, nil, err
+	}
+	return m, byFields, nil
+}
+
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) list(ctx context.Context, i *crudListInput[Model]) (*List[Resp], error) {
+	q := querier.GetQuerier(ctx)
+
+	err := c.authorize(ctx, CRUDList, nil)
+	if err != nil {
+		return nil, err
+	}
+	byFields, err := c.byFields(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	page, err := querier.GetPage[Model](q, byFields, i.PageQuery())
+	if err != nil {
+		if errors.Is(err, querier.ErrInvalidCursor) {
+			return nil, huma.Error422UnprocessableEntity(err.Error())
+		}
+		return nil, err
+	}
+
+	ret := make([]Resp, 0, len(page.Items))
+	for _, m := range page.Items {
+		r, err := c.opts.ToResponse(ctx, &m)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *r)
+	}
+	l := NewPagedList(ret, page)
+	err = l.SetBodyETag()
+	if err != nil {
+		return nil, err
+	}
+	err = i.CheckETag(l.ETag)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) get(ctx context.Context, i *crudItemInput) (*JsonBody[Resp], error) {
+	q := querier.GetQuerier(ctx)
+
+	m, _, err := c.getModel(ctx, q, i.Id, false)
+	if err != nil {
+		return nil, err
+	}
+	err = c.authorize(ctx, CRUDGet, m)
+	if err != nil {
+		return nil, err
+	}
+	etag, err := ModelETag(m)
+	if err != nil {
+		return nil, err
+	}
+	err = i.CheckETag(etag)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.response(ctx, m, etag)
+}
+
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) response(ctx context.Context, m *Model, etag string) (*JsonBody[Resp], error) {
+	r, err := c.opts.ToResponse(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	ret := NewJsonBody(*r)
+	ret.ETag = etag
+	return ret, nil
+}
+
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) create(ctx context.Context, i *crudCreateInput[CreateReq]) (*JsonBody[Resp], error) {
+	q := querier.GetQuerier(ctx)
+
+	err := c.authorize(ctx, CRUDCreate, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.ValidateCreate != nil {
+		err = c.opts.ValidateCreate(ctx, &i.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m, err := c.opts.NewModel(ctx, &i.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = querier.Create(q, m)
+	if err != nil {
+		return nil, err
+	}
+
+	etag, err := ModelETag(m)
+	if err != nil {
+		return nil, err
+	}
+	return c.response(ctx, m, etag)
+}
+
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) update(ctx context.Context, i *crudUpdateInput[UpdateReq]) (*JsonBody[Resp], error) {
+	q := querier.GetQuerier(ctx)
+
+	m, byFields, err := c.getModel(ctx, q, i.Id, true)
+	if err != nil {
+		return nil, err
+	}
+	err = c.authorize(ctx, CRUDUpdate, m)
+	if err != nil {
+		return nil, err
+	}
+	err = c.checkETag(m, &i.ConditionalParams)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.ValidateUpdate != nil {
+		err = c.opts.ValidateUpdate(ctx, m, &i.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fields, err := c.opts.ApplyUpdate(ctx, m, &i.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 0 {
+		err = c.updateFields(q, byFields, m, fields)
+		if err != nil {
+			return nil, err
+		}
+		// re-read the row, so that the ETag reflects the stored state, including the new version
+		m, _, err = c.getModel(ctx, q, i.Id, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	etag, err := ModelETag(m)
+	if err != nil {
+		return nil, err
+	}
+	return c.response(ctx, m, etag)
+}
+
+// updateFields writes the given fields of m. For HasVersion models, the version is incremented and the update
+// only succeeds if the row still has the version m was read with.
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) updateFields(q *querier.Querier, byFields map[string]any, m *Model, fields []string) error {
+	v, ok := any(m).(HasVersion)
+	if !ok {
+		return querier.UpdateOneByFieldsFromStruct(q, byFields, m, fields...)
+	}
+
+	dbFields, _ := querier.GetStructDBFields[Model]()
+	updateValues := map[string]any{}
+	for _, f := range fields {
+		df, ok := dbFields[f]
+		if !ok {
+			return fmt.Errorf("db field %s not found in struct", f)
+		}
+		updateValues[f] = querier.GetStructValueByPath(m, df.Path).Interface()
+	}
+	updateValues["version"] = querier.RawSql("version + 1")
+
+	err := querier.UpdateOneByFields[Model](q, versionedByFields(byFields, v), updateValues)
+	if err != nil {
+		if querier.IsSqlNotFoundError(err) {
+			return versionConflictError()
+		}
+		return err
+	}
+	return nil
+}
+
+// versionedByFields adds the version condition to byFields
+func versionedByFields(byFields map[string]any, v HasVersion) map[string]any {
+	ret := maps.Clone(byFields)
+	ret["version"] = v.GetVersion()
+	return ret
+}
+
+func versionConflictError() error {
+	return huma.NewError(http.StatusPreconditionFailed, "the resource was modified concurrently")
+}
+
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) checkETag(m *Model, p *ConditionalParams) error {
+	etag, err := ModelETag(m)
+	if err != nil {
+		return err
+	}
+	return p.CheckETag(etag)
+}
+
+func (c *crud[Model, CreateReq, UpdateReq, Resp]) delete(ctx context.Context, i *crudItemInput) (*struct{}, error) {
+	q := querier.GetQuerier(ctx)
+
+	m, byFields, err := c.getModel(ctx, q, i.Id, true)
+	if err != nil {
+		return nil, err
+	}
+	err = c.authorize(ctx, CRUDDelete, m)
+	if err != nil {
+		return nil, err
+	}
+	err = c.checkETag(m, &i.ConditionalParams)
+	if err != nil {
+		return nil, err
+	}
+
+	v, versioned := any(m).(HasVersion)
+	if versioned {
+		byFields = versionedByFields(byFields, v)
+	}
+	if sd, ok := any(m).(hasDeletedAt); ok {
+		if sd.GetDeletedAt() != nil {
+			// already deleted, don't touch deleted_at as retention is based on it
+			return nil, nil
+		}
+		err = c.softDelete(q, byFields)
+	} else {
+		err = querier.DeleteOneByFields[Model](q, byFields)
+	}
+	if err != nil {
+		if versioned && querier.IsSqlNotFoundError(err) {
+			return nil, versionConflictError()
+		}
+		return nil, err
+	}
+	return nil, nil
+}
@@ -1,62 +1,317 @@
 package huma_utils
 
 import (
-	"net/http/httputil"
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+type DocsOptions struct {
+	// BasePath is the path the docs are served under. Defaults to /docs.
+	BasePath string
+	// SpecURL is the URL of the OpenAPI spec. Defaults to /openapi.json. Ignored if Specs is set.
+	SpecURL string
+	// Specs are the specs to show, e.g. a public and an internal API. The first one is the default.
+	Specs []DocsSpec
+	// Title is the page title. Defaults to SwaggerUI.
+	Title string
+
+	// Renderer renders the docs page. Defaults to SwaggerUIRenderer().
+	Renderer DocsRenderer
+
+	// OAuth2ClientId is passed to Swagger UI to enable the OAuth2 authorization flow
+	//
+	// Deprecated: use OAuth2
+	OAuth2ClientId string
+	// OAuth2 configures the OAuth2 authorization flow of renderers which support it
+	OAuth2 *DocsOAuth2
+}
+
+type DocsSpec struct {
+	// Name is shown in the spec selector and used as ?spec= query parameter
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type DocsOAuth2 struct {
+	ClientId string
+	Scopes   []string
+	// UsePKCE enables PKCE for the authorization code flow
+	UsePKCE bool
+	// RedirectPath is the OAuth2 redirect path or an absolute URL. Defaults to the renderer's default redirect page.
+	RedirectPath string
+	// SecurityScheme is the name of the OAuth2 security scheme in the spec, required by Scalar
+	SecurityScheme string
+}
+
+// RedirectIsPath reports whether RedirectPath is a path on the docs host, which renderers have to prefix with
+// the origin of the page
+func (o *DocsOAuth2) RedirectIsPath() bool {
+	return strings.HasPrefix(o.RedirectPath, "/") && !strings.HasPrefix(o.RedirectPath, "//")
+}
+
+// DocsRenderer renders the API documentation page. Renderers are self-hosted, all assets are served from
+// Assets under the docs base path. Assets must contain a DocsAssetSumsFile listing the served files.
+type DocsRenderer interface {
+	Name() string
+	Assets() fs.FS
+	// DefaultRedirectPath is the OAuth2 redirect path relative to the base path, used when
+	// DocsOAuth2.RedirectPath is not set
+	DefaultRedirectPath() string
+	Render(w io.Writer, page *DocsPage) error
+}
+
+// DocsPage is passed to DocsRenderer.Render and to the renderer templates
+type DocsPage struct {
+	Title    string
+	BasePath string
+	Specs    []DocsSpec
+	// Spec is the selected spec, for renderers which can only show a single spec
+	Spec   DocsSpec
+	OAuth2 *DocsOAuth2
+
+	assets map[string]docsAsset
+}
+
+// Asset returns the URL of the given asset, including a content hash for cache busting
+func (p *DocsPage) Asset(name string) (string, error) {
+	a, ok := p.assets[name]
+	if !ok {
+		return "", fmt.Errorf("docs asset %s not found", name)
+	}
+	return p.BasePath + "/" + name + "?v=" + a.etag, nil
+}
+
+// Integrity returns the subresource integrity hash of the given asset
+func (p *DocsPage) Integrity(name string) (string, error) {
+	a, ok := p.assets[name]
+	if !ok {
+		return "", fmt.Errorf("docs asset %s not found", name)
+	}
+	return a.integrity, nil
+}
+
+// SpecPageURL returns the URL of the docs page with the given spec selected
+func (p *DocsPage) SpecPageURL(s DocsSpec) string {
+	return p.BasePath + "/?spec=" + url.QueryEscape(s.Name)
+}
+
+type docsAsset struct {
+	data []byte
+	// etag is the hex sha256 of the content, also used as cache-busting query parameter
+	etag string
+	// integrity is the subresource integrity hash of the pinned checksum
+	integrity string
+}
+
+// DocsRendererByName returns the renderer with the given name (swagger-ui, redoc, scalar or elements), so that
+// it can be selected per deployment.
+func DocsRendererByName(name string) (DocsRenderer, error) {
+	switch name {
+	case "", "swagger-ui":
+		return SwaggerUIRenderer(), nil
+	case "redoc":
+		return RedocRenderer(), nil
+	case "scalar":
+		return ScalarRenderer(), nil
+	case "elements":
+		return ElementsRenderer(), nil
+	default:
+		return nil, fmt.Errorf("unknown docs renderer %s", name)
+	}
+}
+
 func InitHumaDocs(ginEngine *gin.Engine, oidcClientId string) error {
-	unpkUrl, err := url.Parse("https://unpkg.com/swagger-ui-dist@5.22.0")
+	return InitHumaDocsWithOptions(ginEngine, DocsOptions{
+		OAuth2ClientId: oidcClientId,
+	})
+}
+
+// InitHumaDocsWithOptions serves the API docs from self-hosted assets, without any requests to third parties.
+// Assets are referenced with a content hash, so that they can be cached forever by browsers.
+func InitHumaDocsWithOptions(ginEngine *gin.Engine, opts DocsOptions) error {
+	if opts.BasePath == "" {
+		opts.BasePath = "/docs"
+	}
+	opts.BasePath = "/" + strings.Trim(opts.BasePath, "/")
+	if len(opts.Specs) == 0 {
+		if opts.SpecURL == "" {
+			opts.SpecURL = "/openapi.json"
+		}
+		opts.Specs = []DocsSpec{{Name: "default", URL: opts.SpecURL}}
+	}
+	if opts.Title == "" {
+		opts.Title = "SwaggerUI"
+	}
+	if opts.Renderer == nil {
+		opts.Renderer = SwaggerUIRenderer()
+	}
+	if opts.OAuth2 == nil && opts.OAuth2ClientId != "" {
+		opts.OAuth2 = &DocsOAuth2{ClientId: opts.OAuth2ClientId}
+	}
+	if opts.OAuth2 != nil && opts.OAuth2.RedirectPath == "" {
+		o := *opts.OAuth2
+		o.RedirectPath = opts.BasePath + "/" + opts.Renderer.DefaultRedirectPath()
+		opts.OAuth2 = &o
+	}
+
+	if opts.Renderer.Assets() == nil {
+		return fmt.Errorf("docs renderer %s has no assets", opts.Renderer.Name())
+	}
+	assets, err := loadDocsAssets(opts.Renderer.Assets())
 	if err != nil {
-		return err
-	}
-	proxy := &httputil.ReverseProxy{
-		Rewrite: func(r *httputil.ProxyRequest) {
-			r.Out.URL.Path = strings.TrimPrefix(r.Out.URL.Path, "/docs/")
-			r.SetURL(unpkUrl)
-			r.Out.Host = unpkUrl.Host
-		},
-	}
-	ginEngine.GET("/docs/*any", func(c *gin.Context) {
-		if c.Request.URL.Path == "/docs" || c.Request.URL.Path == "/docs/" || c.Request.URL.Path == "/docs/index.html" {
-			c.Header("Content-Type", "text/html")
-			_, _ = c.Writer.WriteString(buildSwaggerIndexHtml(oidcClientId))
+		return fmt.Errorf("failed to load assets of docs renderer %s: %w", opts.Renderer.Name(), err)
+	}
+
+	// pre-render one page per selectable spec
+	pages := map[string][]byte{}
+	for _, s := range opts.Specs {
+		if _, ok := pages[s.Name]; ok {
+			return fmt.Errorf("duplicate docs spec name %s", s.Name)
+		}
+		buf := bytes.NewBuffer(nil)
+		err = opts.Renderer.Render(buf, &DocsPage{
+			Title:    opts.Title,
+			BasePath: opts.BasePath,
+			Specs:    opts.Specs,
+			Spec:     s,
+			OAuth2:   opts.OAuth2,
+			assets:   assets,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to render %s docs page: %w", opts.Renderer.Name(), err)
+		}
+		pages[s.Name] = buf.Bytes()
+	}
+
+	serveIndex := func(c *gin.Context) {
+		specName := c.Query("spec")
+		if specName == "" {
+			specName = opts.Specs[0].Name
+		}
+		page, ok := pages[specName]
+		if !ok {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	}
+
+	ginEngine.GET(opts.BasePath, serveIndex)
+	ginEngine.GET(opts.BasePath+"/*any", func(c *gin.Context) {
+		name := strings.TrimPrefix(c.Param("any"), "/")
+		if name == "" || name == "index.html" {
+			serveIndex(c)
+			return
+		}
+		a, ok := assets[name]
+		if !ok {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		c.Header("ETag", `"`+a.etag+`"`)
+		if c.Query("v") == a.etag {
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
 		} else {
-			proxy.ServeHTTP(c.Writer, c.Request)
+			c.Header("Cache-Control", "public, max-age=3600")
 		}
+		http.ServeContent(c.Writer, c.Request, name, time.Time{}, bytes.NewReader(a.data))
 	})
 
 	return nil
 }
 
-func buildSwaggerIndexHtml(oauth2ClientId string) string {
-	return `<!DOCTYPE html>
-	<html lang="en">
-	<head>
-	  <meta charset="utf-8" />
-	  <meta name="viewport" content="width=device-width, initial-scale=1" />
-	  <meta name="description" content="SwaggerUI" />
-	  <title>SwaggerUI</title>
-	  <link rel="stylesheet" href="./swagger-ui.css" />
-	</head>
-	<body>
-	<div id="swagger-ui"></div>
-	<script src="./swagger-ui-bundle.js" crossorigin></script>
-	<script>
-	  window.onload = () => {
-	    window.ui = SwaggerUIBundle({
-	      url: '/openapi.json',
-	      dom_id: '#swagger-ui',
-	      oauth2: {
-	        client_id: "` + oauth2ClientId + `"
-	      }
-	    });
-	  };
-	</script>
-	</body>
-	</html>
-`
+//go:generate go run ../cmd/fetch-docs-assets
+
+// DocsAssetSumsFile lists the sha256 checksums of all docs assets, in the format of sha256sum. Only listed files
+// are served, and they must match the pinned checksums, which are also used for the integrity hashes.
+const DocsAssetSumsFile = "SHA256SUMS"
+
+func loadDocsAssets(fsys fs.FS) (map[string]docsAsset, error) {
+	sums, err := fs.ReadFile(fsys, DocsAssetSumsFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s not found, the assets are not vendored (run go generate ./huma_utils)", DocsAssetSumsFile)
+		}
+		return nil, err
+	}
+
+	ret := map[string]docsAsset{}
+	for _, l := range strings.Split(string(sums), "\n") {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		fields := strings.Fields(l)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid %s line: %s", DocsAssetSumsFile, l)
+		}
+		pinned, err := hex.DecodeString(fields[0])
+		if err != nil || len(pinned) != sha256.Size {
+			return nil, fmt.Errorf("invalid %s checksum: %s", DocsAssetSumsFile, fields[0])
+		}
+		// sha256sum marks binary mode with a * prefix
+		name := strings.TrimPrefix(fields[1], "*")
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.Sum256(data)
+		if !bytes.Equal(h[:], pinned) {
+			return nil, fmt.Errorf("docs asset %s does not match its pinned checksum", name)
+		}
+		ret[name] = docsAsset{
+			data:      data,
+			etag:      fields[0],
+			integrity: "sha256-" + base64.StdEncoding.EncodeToString(pinned),
+		}
+	}
+	return ret, nil
+}
+
+// docsBaseTemplate contains shared templates for the renderers. Renderers clone it and add their page.
+var docsBaseTemplate = template.Must(template.New("base").Parse(`
+{{define "head"}}
+  <meta charset="utf-8" />
+  <meta name="viewport" content="width=device-width, initial-scale=1" />
+  <meta name="description" content="{{.Title}}" />
+  <title>{{.Title}}</title>
+{{end}}
+{{define "spec-selector"}}
+{{if gt (len .Specs) 1}}
+<nav style="padding: 8px 16px; font-family: sans-serif; border-bottom: 1px solid #ddd">
+  {{range .Specs}}
+  <a href="{{$.SpecPageURL .}}" style="margin-right: 16px; {{if eq .Name $.Spec.Name}}font-weight: bold{{end}}">{{.Name}}</a>
+  {{end}}
+</nav>
+{{end}}
+{{end}}
+`))
+
+// embeddedDocsAssets returns the asset directory dir of an embedded renderer
+func embeddedDocsAssets(fsys embed.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+func newDocsTemplate(name string, text string) *template.Template {
+	return template.Must(template.Must(docsBaseTemplate.Clone()).New(name).Parse(text))
 }
@@ -0,0 +1,51 @@
+package huma_utils
+
+import (
+	"embed"
+	"io"
+	"io/fs"
+)
+
+//go:embed elements
+var elementsFs embed.FS
+
+type elementsRenderer struct {
+	assets fs.FS
+}
+
+// ElementsRenderer renders the docs with the embedded Stoplight Elements. Multiple specs get a spec selector.
+// Elements has no OAuth2 authorization flow, tokens must be entered manually.
+func ElementsRenderer() DocsRenderer {
+	return &elementsRenderer{assets: embeddedDocsAssets(elementsFs, "elements")}
+}
+
+func (r *elementsRenderer) Name() string {
+	return "elements"
+}
+
+func (r *elementsRenderer) Assets() fs.FS {
+	return r.assets
+}
+
+func (r *elementsRenderer) DefaultRedirectPath() string {
+	return ""
+}
+
+func (r *elementsRenderer) Render(w io.Writer, page *DocsPage) error {
+	return elementsTemplate.Execute(w, page)
+}
+
+var elementsTemplate = newDocsTemplate("elements", `<!DOCTYPE html>
+<html lang="en">
+<head>
+  {{template "head" .}}
+  <link rel="stylesheet" href="{{.Asset "styles.min.css"}}" integrity="{{.Integrity "styles.min.css"}}" crossorigin="anonymous" />
+  <script src="{{.Asset "web-components.min.js"}}" integrity="{{.Integrity "web-components.min.js"}}" crossorigin="anonymous"></script>
+  <style>body { margin: 0; height: 100vh; display: flex; flex-direction: column; }</style>
+</head>
+<body>
+{{template "spec-selector" .}}
+<elements-api apiDescriptionUrl="{{.Spec.URL}}" router="hash" layout="sidebar" style="flex: 1; min-height: 0"></elements-api>
+</body>
+</html>
+`)
@@ -0,0 +1,50 @@
+package huma_utils
+
+import (
+	"embed"
+	"io"
+	"io/fs"
+)
+
+//go:embed redoc
+var redocFs embed.FS
+
+type redocRenderer struct {
+	assets fs.FS
+}
+
+// RedocRenderer renders the docs with the embedded Redoc. Redoc shows a single spec, so multiple specs get a
+// spec selector. Redoc has no "try it out" and ignores the OAuth2 options.
+func RedocRenderer() DocsRenderer {
+	return &redocRenderer{assets: embeddedDocsAssets(redocFs, "redoc")}
+}
+
+func (r *redocRenderer) Name() string {
+	return "redoc"
+}
+
+func (r *redocRenderer) Assets() fs.FS {
+	return r.assets
+}
+
+func (r *redocRenderer) DefaultRedirectPath() string {
+	return ""
+}
+
+func (r *redocRenderer) Render(w io.Writer, page *DocsPage) error {
+	return redocTemplate.Execute(w, page)
+}
+
+var redocTemplate = newDocsTemplate("redoc", `<!DOCTYPE html>
+<html lang="en">
+<head>
+  {{template "head" .}}
+  <style>body { margin: 0; padding: 0; }</style>
+</head>
+<body>
+{{template "spec-selector" .}}
+<redoc spec-url="{{.Spec.URL}}"></redoc>
+<script src="{{.Asset "redoc.standalone.js"}}" integrity="{{.Integrity "redoc.standalone.js"}}" crossorigin="anonymous"></script>
+</body>
+</html>
+`)
@@ -0,0 +1,113 @@
+package huma_utils
+
+import (
+	"embed"
+	"io"
+	"io/fs"
+)
+
+//go:embed scalar
+var scalarFs embed.FS
+
+type scalarRenderer struct {
+	assets fs.FS
+}
+
+// ScalarRenderer renders the docs with the embedded Scalar API reference. Multiple specs are shown with Scalar's
+// own spec selector. OAuth2 requires DocsOAuth2.SecurityScheme to be set.
+func ScalarRenderer() DocsRenderer {
+	return &scalarRenderer{assets: embeddedDocsAssets(scalarFs, "scalar")}
+}
+
+func (r *scalarRenderer) Name() string {
+	return "scalar"
+}
+
+func (r *scalarRenderer) Assets() fs.FS {
+	return r.assets
+}
+
+func (r *scalarRenderer) DefaultRedirectPath() string {
+	return ""
+}
+
+type scalarSource struct {
+	Title   string `json:"title"`
+	Slug    string `json:"slug"`
+	Url     string `json:"url"`
+	Default bool   `json:"default"`
+}
+
+type scalarPage struct {
+	*DocsPage
+	Config map[string]any
+	// PrefixRedirect is set if the redirect URIs are paths which need the origin of the page
+	PrefixRedirect bool
+}
+
+func (r *scalarRenderer) Render(w io.Writer, page *DocsPage) error {
+	var sources []scalarSource
+	for _, s := range page.Specs {
+		sources = append(sources, scalarSource{
+			Title:   s.Name,
+			Slug:    s.Name,
+			Url:     s.URL,
+			Default: s.Name == page.Spec.Name,
+		})
+	}
+	config := map[string]any{
+		"sources": sources,
+	}
+	if page.OAuth2 != nil && page.OAuth2.SecurityScheme != "" {
+		usePkce := "no"
+		if page.OAuth2.UsePKCE {
+			usePkce = "SHA-256"
+		}
+		scopes := page.OAuth2.Scopes
+		if scopes == nil {
+			scopes = []string{}
+		}
+		config["authentication"] = map[string]any{
+			"preferredSecurityScheme": page.OAuth2.SecurityScheme,
+			"securitySchemes": map[string]any{
+				page.OAuth2.SecurityScheme: map[string]any{
+					"flows": map[string]any{
+						"authorizationCode": map[string]any{
+							"x-scalar-client-id":    page.OAuth2.ClientId,
+							"x-scalar-redirect-uri": page.OAuth2.RedirectPath,
+							"x-usePkce":             usePkce,
+							"selectedScopes":        scopes,
+						},
+					},
+				},
+			},
+		}
+	}
+	return scalarTemplate.Execute(w, scalarPage{
+		DocsPage:       page,
+		Config:         config,
+		PrefixRedirect: config["authentication"] != nil && page.OAuth2.RedirectIsPath(),
+	})
+}
+
+var scalarTemplate = newDocsTemplate("scalar", `<!DOCTYPE html>
+<html lang="en">
+<head>
+  {{template "head" .}}
+</head>
+<body>
+<div id="app"></div>
+<script src="{{.Asset "standalone.js"}}" integrity="{{.Integrity "standalone.js"}}" crossorigin="anonymous"></script>
+<script>
+  const config = {{.Config}};
+  {{- if .PrefixRedirect}}
+  for (const s of Object.values(config.authentication.securitySchemes)) {
+    const flow = s.flows.authorizationCode;
+    flow["x-scalar-redirect-uri"] = window.location.origin + flow["x-scalar-redirect-uri"];
+  }
+  {{- end}}
+  Scalar.createApiReference('#app', config);
+</script>
+</body>
+</html>
+`)
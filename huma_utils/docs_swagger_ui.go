@@ -0,0 +1,83 @@
+package huma_utils
+
+import (
+	"embed"
+	"io"
+	"io/fs"
+)
+
+// SwaggerUIVersion is the version reported by the embedded swagger-ui-dist assets
+const SwaggerUIVersion = "5.29.0"
+
+//go:embed swagger-ui
+var swaggerUIFs embed.FS
+
+type swaggerUIRenderer struct {
+	assets fs.FS
+}
+
+// SwaggerUIRenderer renders the docs with the embedded Swagger UI. Multiple specs are shown with Swagger UI's
+// own spec selector. OAuth2 supports the authorization code flow with PKCE.
+func SwaggerUIRenderer() DocsRenderer {
+	return &swaggerUIRenderer{assets: embeddedDocsAssets(swaggerUIFs, "swagger-ui")}
+}
+
+func (r *swaggerUIRenderer) Name() string {
+	return "swagger-ui"
+}
+
+func (r *swaggerUIRenderer) Assets() fs.FS {
+	return r.assets
+}
+
+func (r *swaggerUIRenderer) DefaultRedirectPath() string {
+	return "oauth2-redirect.html"
+}
+
+func (r *swaggerUIRenderer) Render(w io.Writer, page *DocsPage) error {
+	return swaggerUITemplate.Execute(w, page)
+}
+
+var swaggerUITemplate = newDocsTemplate("swagger-ui", `<!DOCTYPE html>
+<html lang="en">
+<head>
+  {{template "head" .}}
+  <link rel="icon" type="image/png" href="{{.Asset "favicon-32x32.png"}}" sizes="32x32" />
+  <link rel="stylesheet" href="{{.Asset "swagger-ui.css"}}" integrity="{{.Integrity "swagger-ui.css"}}" crossorigin="anonymous" />
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Asset "swagger-ui-bundle.js"}}" integrity="{{.Integrity "swagger-ui-bundle.js"}}" crossorigin="anonymous"></script>
+{{- if gt (len .Specs) 1}}
+<script src="{{.Asset "swagger-ui-standalone-preset.js"}}" integrity="{{.Integrity "swagger-ui-standalone-preset.js"}}" crossorigin="anonymous"></script>
+{{- end}}
+<script>
+  window.onload = () => {
+    window.ui = SwaggerUIBundle({
+      {{- if gt (len .Specs) 1}}
+      urls: {{.Specs}},
+      "urls.primaryName": {{.Spec.Name}},
+      presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+      layout: "StandaloneLayout",
+      {{- else}}
+      url: {{.Spec.URL}},
+      {{- end}}
+      {{- with .OAuth2}}
+      oauth2RedirectUrl: {{if .RedirectIsPath}}window.location.origin + {{end}}{{.RedirectPath}},
+      {{- end}}
+      dom_id: '#swagger-ui'
+    });
+    {{- with .OAuth2}}
+    window.ui.initOAuth({
+      clientId: {{.ClientId}},
+      {{- if .Scopes}}
+      scopes: {{.Scopes}},
+      {{- end}}
+      usePkceWithAuthorizationCodeGrant: {{.UsePKCE}}
+    });
+    {{- end}}
+  };
+</script>
+</body>
+</html>
+`)
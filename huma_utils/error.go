@@ -2,23 +2,31 @@ package huma_utils
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/danielgtaylor/huma/v2"
-	"github.com/dboxed/dboxed-common/db/querier"
 )
 
+var initErrorOverrideOnce sync.Once
+
+// InitHumaErrorOverride makes huma translate internal server errors into RFC 9457 problem details, using the
+// problem registry (see RegisterProblemMapper) and the built-in database error mappings. It is safe to call
+// multiple times.
 func InitHumaErrorOverride() {
-	orig := huma.NewError
-	huma.NewError = func(status int, msg string, errs ...error) huma.StatusError {
-		if status == http.StatusInternalServerError {
-			for _, err := range errs {
-				if querier.IsSqlNotFoundError(err) {
-					status = http.StatusNotFound
-				} else if querier.IsSqlConstraintViolationError(err) {
-					status = http.StatusConflict
+	initErrorOverrideOnce.Do(func() {
+		orig := huma.NewError
+		huma.NewError = func(status int, msg string, errs ...error) huma.StatusError {
+			if status == http.StatusInternalServerError {
+				for _, err := range errs {
+					if err == nil {
+						continue
+					}
+					if p := problems.find(err); p != nil {
+						return p.ErrorModel()
+					}
 				}
 			}
+			return orig(status, msg, errs...)
 		}
-		return orig(status, msg, errs...)
-	}
+	})
 }
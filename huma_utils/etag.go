@@ -0,0 +1,129 @@
+package huma_utils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dboxed/dboxed-common/util"
+)
+
+// HasVersion is implemented by models with a version column, which is then used as ETag instead of a hash of
+// the model. RegisterCRUD increments the version on every update.
+type HasVersion interface {
+	GetVersion() int64
+}
+
+// ETagForValue returns a strong ETag based on the sha256 of the JSON representation of v
+func ETagForValue(v any) (string, error) {
+	h, err := util.Sha256SumJson(v)
+	if err != nil {
+		return "", err
+	}
+	return `"` + h + `"`, nil
+}
+
+// ETagForVersion returns a strong ETag for a version column value
+func ETagForVersion(version int64) string {
+	return fmt.Sprintf(`"v%d"`, version)
+}
+
+// ModelETag returns the ETag of a model, using its version if it implements HasVersion
+func ModelETag(m any) (string, error) {
+	if v, ok := m.(HasVersion); ok {
+		return ETagForVersion(v.GetVersion()), nil
+	}
+	return ETagForValue(m)
+}
+
+// SetBodyETag sets the ETag header to a hash of the body
+func (b *JsonBody[T]) SetBodyETag() error {
+	etag, err := ETagForValue(b.Body)
+	if err != nil {
+		return err
+	}
+	b.ETag = etag
+	return nil
+}
+
+// SetBodyETag sets the ETag header to a hash of the body
+func (l *List[T]) SetBodyETag() error {
+	etag, err := ETagForValue(l.Body)
+	if err != nil {
+		return err
+	}
+	l.ETag = etag
+	return nil
+}
+
+// ConditionalParams are the If-Match and If-None-Match headers. Embed it into the operation input and call
+// CheckETag with the current ETag of the resource.
+type ConditionalParams struct {
+	IfMatch     []string `header:"If-Match" doc:"Succeeds if the current ETag of the resource matches one of the passed values. Use * to match any existing resource."`
+	IfNoneMatch []string `header:"If-None-Match" doc:"Succeeds if the current ETag of the resource matches none of the passed values. Use * to match any existing resource."`
+
+	isRead bool
+}
+
+func (p *ConditionalParams) Resolve(ctx huma.Context) []error {
+	switch ctx.Method() {
+	case http.MethodGet, http.MethodHead:
+		p.isRead = true
+	default:
+		p.isRead = false
+	}
+	return nil
+}
+
+// CheckETag checks the conditional headers against the current ETag of the resource, which is empty if the
+// resource does not exist. A non-matching If-Match results in 412 Precondition Failed. A matching If-None-Match
+// results in 304 Not Modified (with the ETag header) on reads and in 412 Precondition Failed on writes.
+func (p *ConditionalParams) CheckETag(etag string) error {
+	if len(p.IfMatch) != 0 && !matchETags(p.IfMatch, etag, false) {
+		return huma.NewError(http.StatusPreconditionFailed, "If-Match precondition failed, the resource was modified", &huma.ErrorDetail{
+			Message:  "does not match the current ETag",
+			Location: "header.If-Match",
+			Value:    p.IfMatch,
+		})
+	}
+	if len(p.IfNoneMatch) != 0 && matchETags(p.IfNoneMatch, etag, true) {
+		if p.isRead {
+			// 304 responses must carry the ETag, see RFC 9110 section 15.4.5
+			header := http.Header{}
+			header.Set("ETag", etag)
+			return huma.ErrorWithHeaders(huma.Status304NotModified(), header)
+		}
+		return huma.NewError(http.StatusPreconditionFailed, "If-None-Match precondition failed, the resource exists", &huma.ErrorDetail{
+			Message:  "matches the current ETag",
+			Location: "header.If-None-Match",
+			Value:    p.IfNoneMatch,
+		})
+	}
+	return nil
+}
+
+// matchETags checks if any of the header values matches etag. If-None-Match uses the weak comparison, which
+// ignores the W/ prefix, If-Match the strong one.
+func matchETags(values []string, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, v := range values {
+		for _, x := range strings.Split(v, ",") {
+			x = strings.TrimSpace(x)
+			if x == "*" {
+				return true
+			}
+			if weak {
+				x = strings.TrimPrefix(x, "W/")
+			} else if strings.HasPrefix(x, "W/") {
+				continue
+			}
+			if x == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,366 @@
+package huma_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/adapters/humagin"
+	"github.com/dboxed/dboxed-common/db/querier"
+	"github.com/dboxed/dboxed-common/util"
+)
+
+// IdempotencyKey (bool) marks operations which honor the Idempotency-Key header, set via MetadataModifier
+const IdempotencyKey = "idempotency-key"
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+type IdempotencyOptions struct {
+	// Table is the table the keys are stored in. Defaults to idempotency_key. The table is expected to look
+	// like this:
+	//
+	//	create table idempotency_key (
+	//	    id           TYPES_INT_PRIMARY_KEY,
+	//	    created_at   TYPES_DATETIME not null,
+	//	    scope        text   not null,
+	//	    idem_key     text   not null,
+	//	    request_hash text   not null,
+	//	    status       bigint not null,
+	//	    headers      text   not null,
+	//	    body         TYPES_BLOB not null
+	//	);
+	//	create unique index idempotency_key_key on idempotency_key (scope, idem_key);
+	//	create index idempotency_key_created_at on idempotency_key (created_at);
+	Table string
+	// TTL is the time after which keys expire and can be reused. Defaults to 24h.
+	TTL time.Duration
+	// Required rejects requests to marked operations without Idempotency-Key header
+	Required bool
+	// Scope returns the scope of the key, e.g. the user id, so that clients can't replay responses of others
+	Scope func(ctx huma.Context) (string, error)
+}
+
+type idempotencyRecord struct {
+	ID          int64     `db:"id"`
+	CreatedAt   time.Time `db:"created_at"`
+	Scope       string    `db:"scope"`
+	Key         string    `db:"idem_key"`
+	RequestHash string    `db:"request_hash"`
+	Status      int       `db:"status"`
+	Headers     string    `db:"headers"`
+	Body        []byte    `db:"body"`
+}
+
+// IdempotencyKeyOperation marks the operation with IdempotencyKey and documents the Idempotency-Key header
+func IdempotencyKeyOperation() func(op *huma.Operation) {
+	return func(op *huma.Operation) {
+		MetadataModifier(IdempotencyKey, true)(op)
+		op.Parameters = append(op.Parameters, &huma.Param{
+			Name:        IdempotencyKeyHeader,
+			In:          "header",
+			Description: "Unique key of the request. Retries with the same key return the stored response instead of executing the operation again.",
+			Schema: &huma.Schema{
+				Type:      huma.TypeString,
+				MaxLength: util.Ptr(255),
+			},
+		})
+	}
+}
+
+func (o *IdempotencyOptions) setDefaults() {
+	if o.Table == "" {
+		o.Table = "idempotency_key"
+	}
+	if o.TTL == 0 {
+		o.TTL = 24 * time.Hour
+	}
+}
+
+// SetupIdempotencyMiddleware replays the stored response when a request to an operation marked with
+// IdempotencyKey is repeated with the same Idempotency-Key header. Reusing a key with a different request
+// results in 422, concurrent requests with the same key wait for the first one and then replay its response.
+// Keys and responses are stored in the request transaction, so this must be set up after SetupTxMiddlewares.
+// Only successful responses are stored.
+func SetupIdempotencyMiddleware(humaApi huma.API, opts IdempotencyOptions) {
+	opts.setDefaults()
+
+	humaApi.UseMiddleware(func(ctx huma.Context, next func(huma.Context)) {
+		if !HasMetadataTrue(ctx, IdempotencyKey) {
+			next(ctx)
+			return
+		}
+		key := ctx.Header(IdempotencyKeyHeader)
+		if key == "" {
+			if opts.Required {
+				huma.WriteErr(humaApi, ctx, http.StatusBadRequest, fmt.Sprintf("missing %s header", IdempotencyKeyHeader))
+				return
+			}
+			next(ctx)
+			return
+		}
+		if len(key) > 255 {
+			huma.WriteErr(humaApi, ctx, http.StatusBadRequest, fmt.Sprintf("%s header is too long", IdempotencyKeyHeader))
+			return
+		}
+		if !querier.HasTX(ctx.Context()) {
+			huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "idempotency keys require a transaction")
+			return
+		}
+		scope := ""
+		if opts.Scope != nil {
+			var err error
+			scope, err = opts.Scope(ctx)
+			if err != nil {
+				huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "failed to determine idempotency key scope", err)
+				return
+			}
+		}
+
+		ginCtx := humagin.Unwrap(ctx)
+		var body []byte
+		if ginCtx.Request.Body != nil {
+			var err error
+			body, err = io.ReadAll(ginCtx.Request.Body)
+			if err != nil {
+				huma.WriteErr(humaApi, ctx, http.StatusBadRequest, "failed to read request body", err)
+				return
+			}
+			ginCtx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		requestHash, err := util.Sha256SumJson(map[string]any{
+			"method": ctx.Method(),
+			"url":    ginCtx.Request.URL.RequestURI(),
+			"body":   body,
+		})
+		if err != nil {
+			huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "failed to hash request", err)
+			return
+		}
+
+		q := querier.GetQuerier(ctx.Context())
+		rec, err := lockIdempotencyKey(q, &opts, scope, key, requestHash)
+		if err != nil {
+			huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "failed to store idempotency key", err)
+			return
+		}
+		if rec != nil {
+			replayIdempotentResponse(humaApi, ctx, rec, requestHash)
+			return
+		}
+
+		keyArgs := map[string]any{
+			"scope":    scope,
+			"idem_key": key,
+		}
+		origHeader := ginCtx.Writer.Header().Clone()
+		w := &idempotencyCaptureWriter{
+			ctx: ctx,
+			onStream: func() error {
+				// streamed responses can't be replayed
+				_, err := q.ExecNamed(fmt.Sprintf(`delete from "%s" where scope = :scope and idem_key = :idem_key`, opts.Table), keyArgs)
+				return err
+			},
+		}
+		next(&idempotencyContext{humaContext: ctx, w: w})
+
+		if w.streamed {
+			return
+		}
+		if isSuccessStatus(ctx.Status()) {
+			// only store the headers set by the operation, not those of outer middlewares
+			header := http.Header{}
+			for k, v := range ginCtx.Writer.Header() {
+				if !slices.Equal(v, origHeader[k]) {
+					header[k] = v
+				}
+			}
+			err = storeIdempotentResponse(q, &opts, ctx.Status(), header, w.buf.Bytes(), keyArgs)
+			if err != nil {
+				h := ginCtx.Writer.Header()
+				clear(h)
+				for k, v := range origHeader {
+					h[k] = v
+				}
+				huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "failed to store idempotent response", err)
+				return
+			}
+		}
+		// on errors, the transaction is rolled back and with it the key
+		w.writeBuffered()
+	})
+}
+
+func storeIdempotentResponse(q *querier.Querier, opts *IdempotencyOptions, status int, header http.Header, body []byte, keyArgs map[string]any) error {
+	headers, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	args := map[string]any{
+		"status":  status,
+		"headers": string(headers),
+		"body":    body,
+	}
+	maps.Copy(args, keyArgs)
+	_, err = q.ExecNamed(fmt.Sprintf(`update "%s" set status = :status, headers = :headers, body = :body
+		where scope = :scope and idem_key = :idem_key`, opts.Table), args)
+	return err
+}
+
+// lockIdempotencyKey returns the stored record for the key, or inserts a new incomplete one and returns nil.
+// The unique index makes concurrent requests with the same key wait for each other's transaction, the stored
+// record is then locked until the end of the transaction.
+func lockIdempotencyKey(q *querier.Querier, opts *IdempotencyOptions, scope string, key string, requestHash string) (*idempotencyRecord, error) {
+	now := time.Now().UTC()
+	args := map[string]any{
+		"scope":        scope,
+		"idem_key":     key,
+		"cutoff":       now.Add(-opts.TTL),
+		"now":          now,
+		"request_hash": requestHash,
+		"body":         []byte{},
+	}
+
+	_, err := q.ExecNamed(fmt.Sprintf(`delete from "%s" where scope = :scope and idem_key = :idem_key and created_at < :cutoff`, opts.Table), args)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := q.ExecNamed(fmt.Sprintf(`insert into "%s" (created_at, scope, idem_key, request_hash, status, headers, body)
+		values (:now, :scope, :idem_key, :request_hash, 0, '{}', :body)
+		on conflict (scope, idem_key) do nothing`, opts.Table), args)
+	if err != nil {
+		return nil, err
+	}
+	inserted, err := r.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if inserted != 0 {
+		return nil, nil
+	}
+
+	// the key exists, either from an earlier or from a concurrent request which committed in the meantime
+	selectQuery := fmt.Sprintf(`select * from "%s" where scope = :scope and idem_key = :idem_key`, opts.Table)
+	var rec idempotencyRecord
+	err = q.GetNamed(&rec, map[string]string{
+		"pgx":     selectQuery + " for update",
+		"sqlite3": selectQuery,
+	}, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func replayIdempotentResponse(humaApi huma.API, ctx huma.Context, rec *idempotencyRecord, requestHash string) {
+	if rec.RequestHash != requestHash {
+		huma.WriteErr(humaApi, ctx, http.StatusUnprocessableEntity, fmt.Sprintf("%s was already used for a different request", IdempotencyKeyHeader))
+		return
+	}
+	if rec.Status == 0 {
+		huma.WriteErr(humaApi, ctx, http.StatusConflict, fmt.Sprintf("a request with the same %s is in progress", IdempotencyKeyHeader))
+		return
+	}
+
+	var headers http.Header
+	err := json.Unmarshal([]byte(rec.Headers), &headers)
+	if err != nil {
+		huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "failed to replay idempotent response", err)
+		return
+	}
+	for k, values := range headers {
+		for i, v := range values {
+			if i == 0 {
+				ctx.SetHeader(k, v)
+			} else {
+				ctx.AppendHeader(k, v)
+			}
+		}
+	}
+	ctx.SetHeader(IdempotencyReplayedHeader, "true")
+	ctx.SetStatus(rec.Status)
+	_, _ = ctx.BodyWriter().Write(rec.Body)
+}
+
+// PurgeExpiredIdempotencyKeys deletes keys older than the TTL and returns the number of deleted keys
+func PurgeExpiredIdempotencyKeys(q *querier.Querier, opts IdempotencyOptions, now time.Time) (int64, error) {
+	opts.setDefaults()
+	r, err := q.ExecNamed(fmt.Sprintf(`delete from "%s" where created_at < :cutoff`, opts.Table), map[string]any{
+		"cutoff": now.UTC().Add(-opts.TTL),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+// idempotencyContext captures the response body while passing it through
+type idempotencyContext struct {
+	humaContext
+	w *idempotencyCaptureWriter
+}
+
+func (c *idempotencyContext) Unwrap() huma.Context {
+	return c.humaContext
+}
+
+func (c *idempotencyContext) BodyWriter() io.Writer {
+	return c.w
+}
+
+// idempotencyCaptureWriter buffers the response body until it is stored. Flushing switches to unbuffered
+// writes and drops the key.
+type idempotencyCaptureWriter struct {
+	ctx      huma.Context
+	onStream func() error
+
+	buf      bytes.Buffer
+	streamed bool
+	err      error
+}
+
+func (w *idempotencyCaptureWriter) writeBuffered() {
+	if w.buf.Len() == 0 {
+		return
+	}
+	_, _ = w.ctx.BodyWriter().Write(w.buf.Bytes())
+	w.buf.Reset()
+}
+
+func (w *idempotencyCaptureWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.streamed {
+		return w.ctx.BodyWriter().Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *idempotencyCaptureWriter) Flush() {
+	if w.err != nil {
+		return
+	}
+	if !w.streamed {
+		w.streamed = true
+		w.err = w.onStream()
+		if w.err != nil {
+			slog.ErrorContext(w.ctx.Context(), "failed to drop idempotency key", slog.Any("error", w.err))
+			return
+		}
+		w.writeBuffered()
+	}
+	if f, ok := w.ctx.BodyWriter().(http.Flusher); ok {
+		f.Flush()
+	}
+}
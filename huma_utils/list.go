@@ -0,0 +1,291 @@
+package huma_utils
+
+import (
+	"database/sql"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dboxed/dboxed-common/db/querier"
+)
+
+// ListParams are the query parameters for listing T. Besides limit, offset, cursor and sort, it accepts filters
+// in the form filter[field][op]=value or filter[field]=value (same as eq), see querier.FilterOps for the
+// supported ops. Only db fields of T which are explicitly allowed via the list tag can be used, e.g.
+// `db:"name" list:"filter,sort"`. Nullable fields can't be used for sorting. Use ListParamsOperation[T] to
+// document the filters.
+type ListParams[T any] struct {
+	Limit  int    `query:"limit" minimum:"1" maximum:"1000" default:"100" doc:"Maximum number of items to return"`
+	Offset int    `query:"offset" minimum:"0" doc:"Number of items to skip. Can't be combined with cursor."`
+	Cursor string `query:"cursor" doc:"next_cursor or prev_cursor from a previous response"`
+	Sort   string `query:"sort" doc:"Comma separated list of fields to sort by, prefixed with - for descending order"`
+
+	filters []querier.Filter
+	sort    []querier.SortField
+}
+
+// listFields returns the db fields of T which have opt ("filter" or "sort") in their list tag
+func listFields[T any](opt string) map[string]querier.StructDBField {
+	dbFields, _ := querier.GetStructDBFields[T]()
+	ret := map[string]querier.StructDBField{}
+	for k, f := range dbFields {
+		if slices.Contains(strings.Split(f.StructField.Tag.Get("list"), ","), opt) {
+			ret[k] = f
+		}
+	}
+	return ret
+}
+
+func (p *ListParams[T]) Resolve(ctx huma.Context) []error {
+	sortFields := listFields[T]("sort")
+	filterFields := listFields[T]("filter")
+
+	var errs []error
+	p.sort = nil
+	if p.Sort != "" {
+		for _, s := range strings.Split(p.Sort, ",") {
+			sf := querier.SortField{Field: strings.TrimSpace(s)}
+			if strings.HasPrefix(sf.Field, "-") {
+				sf.Field = sf.Field[1:]
+				sf.Desc = true
+			}
+			df, ok := sortFields[sf.Field]
+			if !ok {
+				errs = append(errs, &huma.ErrorDetail{
+					Location: "query.sort",
+					Message:  fmt.Sprintf("unknown sort field %s", sf.Field),
+					Value:    p.Sort,
+				})
+				continue
+			}
+			if querier.IsNullableField(df) {
+				errs = append(errs, &huma.ErrorDetail{
+					Location: "query.sort",
+					Message:  fmt.Sprintf("can't sort by nullable field %s", sf.Field),
+					Value:    p.Sort,
+				})
+				continue
+			}
+			p.sort = append(p.sort, sf)
+		}
+	}
+
+	p.filters = nil
+	u := ctx.URL()
+	for k, values := range u.Query() {
+		if !strings.HasPrefix(k, "filter[") {
+			continue
+		}
+		field, op, ok := parseFilterKey(k)
+		if !ok {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: "query." + k,
+				Message:  "invalid filter, expected filter[field][op]",
+			})
+			continue
+		}
+		df, ok := filterFields[field]
+		if !ok {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: "query." + k,
+				Message:  fmt.Sprintf("unknown filter field %s", field),
+			})
+			continue
+		}
+		if !slices.Contains(querier.FilterOps, op) {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: "query." + k,
+				Message:  fmt.Sprintf("unknown filter op %s", op),
+			})
+			continue
+		}
+		for _, s := range values {
+			v, err := convertFilterValue(df.StructField.Type, op, s)
+			if err != nil {
+				errs = append(errs, &huma.ErrorDetail{
+					Location: "query." + k,
+					Message:  err.Error(),
+					Value:    s,
+				})
+				continue
+			}
+			p.filters = append(p.filters, querier.Filter{Field: field, Op: op, Value: v})
+		}
+	}
+	// query maps are unordered, keep the generated SQL stable
+	slices.SortFunc(p.filters, func(a, b querier.Filter) int {
+		return strings.Compare(a.Field+"/"+string(a.Op), b.Field+"/"+string(b.Op))
+	})
+
+	if p.Cursor != "" && p.Offset != 0 {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "query.cursor",
+			Message:  "cursor and offset can't be combined",
+		})
+	}
+	return errs
+}
+
+// PageQuery converts the params into a querier.PageQuery
+func (p *ListParams[T]) PageQuery() querier.PageQuery {
+	return querier.PageQuery{
+		Filters: p.filters,
+		Sort:    p.sort,
+		Limit:   p.Limit,
+		Offset:  p.Offset,
+		Cursor:  p.Cursor,
+	}
+}
+
+func parseFilterKey(k string) (string, querier.FilterOp, bool) {
+	// filter[field] or filter[field][op]
+	rest := strings.TrimPrefix(k, "filter")
+	var parts []string
+	for rest != "" {
+		if rest[0] != '[' {
+			return "", "", false
+		}
+		end := strings.IndexByte(rest, ']')
+		if end == -1 {
+			return "", "", false
+		}
+		parts = append(parts, rest[1:end])
+		rest = rest[end+1:]
+	}
+	switch len(parts) {
+	case 1:
+		return parts[0], querier.FilterEq, parts[0] != ""
+	case 2:
+		return parts[0], querier.FilterOp(parts[1]), parts[0] != ""
+	default:
+		return "", "", false
+	}
+}
+
+func convertFilterValue(t reflect.Type, op querier.FilterOp, s string) (any, error) {
+	switch op {
+	case querier.FilterNull:
+		return strconv.ParseBool(s)
+	case querier.FilterLike:
+		return s, nil
+	case querier.FilterIn:
+		var ret []any
+		for _, x := range strings.Split(s, ",") {
+			v, err := convertFilterScalar(t, x)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	default:
+		return convertFilterScalar(t, s)
+	}
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+var nullTimeType = reflect.TypeFor[sql.NullTime]()
+
+// convertFilterScalar converts the query string value into the Go type of the field, so that the database
+// driver compares it with the column as the right type
+func convertFilterScalar(t reflect.Type, s string) (any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType || t == nullTimeType {
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	if t.Kind() == reflect.Struct {
+		// sql.Null[T], querier.NullForJoin[T] and friends
+		if f, ok := t.FieldByName("V"); ok {
+			return convertFilterScalar(f.Type, s)
+		}
+		for _, n := range []string{"String", "Int64", "Int32", "Int16", "Float64", "Bool", "Byte"} {
+			if f, ok := t.FieldByName(n); ok {
+				return convertFilterScalar(f.Type, s)
+			}
+		}
+		return s, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer")
+		}
+		return v, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an unsigned integer")
+		}
+		return v, nil
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number")
+		}
+		return v, nil
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("expected a boolean")
+		}
+		return v, nil
+	default:
+		return s, nil
+	}
+}
+
+// ListParamsOperation documents the filter[field][op] query parameters of ListParams[T] in the operation
+func ListParamsOperation[T any]() func(op *huma.Operation) {
+	return func(op *huma.Operation) {
+		filterNames := slices.Sorted(maps.Keys(listFields[T]("filter")))
+		var sortNames []string
+		for k, f := range listFields[T]("sort") {
+			if !querier.IsNullableField(f) {
+				sortNames = append(sortNames, k)
+			}
+		}
+		slices.Sort(sortNames)
+
+		var ops []string
+		for _, o := range querier.FilterOps {
+			ops = append(ops, string(o))
+		}
+
+		props := map[string]*huma.Schema{}
+		for _, n := range filterNames {
+			opProps := map[string]*huma.Schema{}
+			for _, o := range ops {
+				opProps[o] = &huma.Schema{Type: huma.TypeString}
+			}
+			props[n] = &huma.Schema{
+				Type:       huma.TypeObject,
+				Properties: opProps,
+			}
+		}
+
+		explode := true
+		op.Parameters = append(op.Parameters, &huma.Param{
+			Name: "filter",
+			In:   "query",
+			Description: fmt.Sprintf("Filters in the form filter[field][op]=value, with op one of %s. "+
+				"filter[field]=value is the same as eq. in expects a comma separated list, null expects true or false. "+
+				"Filter fields: %s. Sort fields: %s",
+				strings.Join(ops, ", "), strings.Join(filterNames, ", "), strings.Join(sortNames, ", ")),
+			Style:   "deepObject",
+			Explode: &explode,
+			Schema: &huma.Schema{
+				Type:       huma.TypeObject,
+				Properties: props,
+			},
+		})
+	}
+}
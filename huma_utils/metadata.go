@@ -1,6 +1,11 @@
 package huma_utils
 
-import "github.com/danielgtaylor/huma/v2"
+import (
+	"fmt"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
 
 func GetMetadataBool(m map[string]any, key string) *bool {
 	if m == nil {
@@ -41,6 +46,24 @@ func HasMetadataFalse(ctx huma.Context, key string) bool {
 	return HasMetadataFalse2(ctx.Operation().Metadata, key)
 }
 
+// getMetadataDuration returns the time.Duration or duration string stored under key, or 0 if not set
+func getMetadataDuration(m map[string]any, key string) (time.Duration, error) {
+	switch v := m[key].(type) {
+	case nil:
+		return 0, nil
+	case time.Duration:
+		return v, nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s metadata: %w", key, err)
+		}
+		return d, nil
+	default:
+		return 0, fmt.Errorf("invalid %s metadata type %T", key, v)
+	}
+}
+
 func MetadataModifier(key string, value any) func(o *huma.Operation) {
 	return func(o *huma.Operation) {
 		if o.Metadata != nil {
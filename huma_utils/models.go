@@ -1,6 +1,10 @@
 package huma_utils
 
+import "github.com/dboxed/dboxed-common/db/querier"
+
 type JsonBody[T any] struct {
+	// ETag is optional, see SetBodyETag
+	ETag string `header:"ETag"`
 	Body T
 }
 
@@ -21,12 +25,17 @@ type Empty struct {
 }
 
 type List[T any] struct {
+	// ETag is optional, see SetBodyETag
+	ETag string `header:"ETag"`
 	Body ListBody[T]
 }
 
 type ListBody[T any] struct {
 	Items      []T `json:"items"`
 	TotalCount int `json:"total_count"`
+
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
 
 func NewList[T any](l []T, totalCount int) *List[T] {
@@ -40,3 +49,11 @@ func NewList[T any](l []T, totalCount int) *List[T] {
 		},
 	}
 }
+
+// NewPagedList returns a list with the total count and cursors of page. items are the mapped page items.
+func NewPagedList[T any, M any](items []T, page *querier.Page[M]) *List[T] {
+	l := NewList(items, page.TotalCount)
+	l.Body.NextCursor = page.NextCursor
+	l.Body.PrevCursor = page.PrevCursor
+	return l
+}
@@ -0,0 +1,229 @@
+package huma_utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dboxed/dboxed-common/db/querier"
+)
+
+// ProblemTypeBase is prepended to the problem types of the built-in database error mappings
+var ProblemTypeBase = "urn:problem-type:"
+
+const (
+	ProblemTypeNotFound            = "not-found"
+	ProblemTypeUniqueViolation     = "unique-violation"
+	ProblemTypeForeignKeyViolation = "foreign-key-violation"
+	ProblemTypeStillReferenced     = "still-referenced"
+	ProblemTypeNotNullViolation    = "not-null-violation"
+	ProblemTypeCheckViolation      = "check-violation"
+)
+
+// Problem is an RFC 9457 problem detail, rendered as huma.ErrorModel
+type Problem struct {
+	// Type is a stable URI identifying the problem type
+	Type   string
+	Title  string
+	Status int
+	Detail string
+	// Fields are the JSON fields the problem relates to, reported as body.<field> error locations
+	Fields []string
+}
+
+func (p *Problem) ErrorModel() *huma.ErrorModel {
+	ret := &huma.ErrorModel{
+		Type:   p.Type,
+		Title:  p.Title,
+		Status: p.Status,
+		Detail: p.Detail,
+	}
+	if ret.Title == "" {
+		ret.Title = http.StatusText(p.Status)
+	}
+	for _, f := range p.Fields {
+		ret.Errors = append(ret.Errors, &huma.ErrorDetail{
+			Message:  p.Detail,
+			Location: "body." + f,
+		})
+	}
+	return ret
+}
+
+// ProblemMapper translates err into a problem. It returns nil if it does not handle err.
+type ProblemMapper func(err error) *Problem
+
+type problemRegistry struct {
+	m       sync.RWMutex
+	mappers []ProblemMapper
+
+	// table -> column -> JSON field
+	fields map[string]map[string]string
+	// constraint -> JSON fields
+	constraints map[string][]string
+}
+
+var problems = &problemRegistry{
+	fields:      map[string]map[string]string{},
+	constraints: map[string][]string{},
+}
+
+// RegisterProblemMapper adds a mapper to the registry used by InitHumaErrorOverride. Mappers registered later
+// take precedence over earlier ones and over the built-in database error mappings.
+func RegisterProblemMapper(m ProblemMapper) {
+	problems.m.Lock()
+	defer problems.m.Unlock()
+	problems.mappers = append(problems.mappers, m)
+}
+
+// RegisterErrorProblem maps all errors matching target (via errors.Is) to the given problem. If p.Detail is
+// empty, the error message is used.
+func RegisterErrorProblem(target error, p Problem) {
+	RegisterProblemMapper(func(err error) *Problem {
+		if !errors.Is(err, target) {
+			return nil
+		}
+		ret := p
+		if ret.Detail == "" {
+			ret.Detail = err.Error()
+		}
+		return &ret
+	})
+}
+
+// RegisterProblemFields maps the columns of table to JSON field names for constraint violations. Columns
+// without mapping are reported with their column name.
+func RegisterProblemFields(table string, columnToField map[string]string) {
+	problems.m.Lock()
+	defer problems.m.Unlock()
+	m, ok := problems.fields[table]
+	if !ok {
+		m = map[string]string{}
+		problems.fields[table] = m
+	}
+	for k, v := range columnToField {
+		m[k] = v
+	}
+}
+
+// RegisterProblemConstraint maps a named constraint to JSON field names, e.g. for check constraints where the
+// database does not report the affected columns
+func RegisterProblemConstraint(constraint string, fields ...string) {
+	problems.m.Lock()
+	defer problems.m.Unlock()
+	problems.constraints[constraint] = fields
+}
+
+// RegisterProblemModel registers the column to JSON field mapping of all fields of T which have both a db and
+// a json tag
+func RegisterProblemModel[T any]() {
+	dbFields, _ := querier.GetStructDBFields[T]()
+	m := map[string]string{}
+	table := querier.GetTableName[T]()
+	for _, f := range dbFields {
+		if f.Join != nil {
+			continue
+		}
+		jsonName, _, _ := strings.Cut(f.StructField.Tag.Get("json"), ",")
+		if jsonName == "" || jsonName == "-" {
+			continue
+		}
+		m[f.ColumnName] = jsonName
+	}
+	if len(m) != 0 {
+		RegisterProblemFields(table, m)
+	}
+}
+
+func (r *problemRegistry) find(err error) *Problem {
+	r.m.RLock()
+	mappers := slices.Clone(r.mappers)
+	r.m.RUnlock()
+
+	for _, m := range slices.Backward(mappers) {
+		if p := m(err); p != nil {
+			return p
+		}
+	}
+	return r.sqlProblem(err)
+}
+
+func (r *problemRegistry) sqlProblem(err error) *Problem {
+	if querier.IsSqlNotFoundError(err) {
+		return &Problem{
+			Type:   ProblemTypeBase + ProblemTypeNotFound,
+			Status: http.StatusNotFound,
+			Detail: "resource not found",
+		}
+	}
+
+	ce := querier.ParseSqlConstraintError(err)
+	if ce == nil {
+		return nil
+	}
+	fields := r.constraintFields(ce)
+
+	p := &Problem{
+		Fields: fields,
+	}
+	what := "value"
+	if len(fields) != 0 {
+		what = strings.Join(fields, ", ")
+	}
+	switch ce.Kind {
+	case querier.SqlUniqueViolation:
+		p.Type = ProblemTypeBase + ProblemTypeUniqueViolation
+		p.Status = http.StatusConflict
+		p.Detail = fmt.Sprintf("a resource with the same %s already exists", what)
+	case querier.SqlForeignKeyViolation:
+		if ce.StillReferenced {
+			p.Type = ProblemTypeBase + ProblemTypeStillReferenced
+			p.Status = http.StatusConflict
+			p.Detail = "resource is still referenced by other resources"
+			p.Fields = nil
+		} else if ce.ReferenceMissing {
+			p.Type = ProblemTypeBase + ProblemTypeForeignKeyViolation
+			p.Status = http.StatusUnprocessableEntity
+			p.Detail = fmt.Sprintf("referenced resource in %s does not exist", what)
+		} else {
+			p.Type = ProblemTypeBase + ProblemTypeForeignKeyViolation
+			p.Status = http.StatusConflict
+			p.Detail = fmt.Sprintf("referenced resource in %s does not exist or is still referenced", what)
+		}
+	case querier.SqlNotNullViolation:
+		p.Type = ProblemTypeBase + ProblemTypeNotNullViolation
+		p.Status = http.StatusUnprocessableEntity
+		p.Detail = fmt.Sprintf("%s is required", what)
+	case querier.SqlCheckViolation:
+		p.Type = ProblemTypeBase + ProblemTypeCheckViolation
+		p.Status = http.StatusUnprocessableEntity
+		p.Detail = fmt.Sprintf("invalid %s", what)
+	default:
+		return nil
+	}
+	return p
+}
+
+func (r *problemRegistry) constraintFields(ce *querier.SqlConstraintError) []string {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	if ce.Constraint != "" {
+		if fields, ok := r.constraints[ce.Constraint]; ok {
+			return fields
+		}
+	}
+	var ret []string
+	for _, c := range ce.Columns {
+		f, ok := r.fields[ce.Table][c]
+		if !ok {
+			f = c
+		}
+		ret = append(ret, f)
+	}
+	return ret
+}
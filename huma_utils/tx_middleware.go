@@ -1,8 +1,14 @@
 package huma_utils
 
 import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"sync"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humagin"
@@ -13,7 +19,31 @@ import (
 
 const NoTx = "no-tx"
 
+// Operation metadata to configure the request transaction, set via MetadataModifier
+const (
+	// TxReadOnly (bool) begins a read-only transaction
+	TxReadOnly = "tx-read-only"
+	// TxIsolationLevel (sql.IsolationLevel or a name like "serializable" or "repeatable read")
+	TxIsolationLevel = "tx-isolation-level"
+	// TxStatementTimeout (time.Duration or a duration string like "5s")
+	TxStatementTimeout = "tx-statement-timeout"
+	// TxLockTimeout (time.Duration or a duration string like "5s")
+	TxLockTimeout = "tx-lock-timeout"
+	// TxRetries (int) retries the operation up to the given number of times when it fails with a serialization
+	// failure or deadlock. Only applied to idempotent methods (GET, HEAD, OPTIONS, PUT, DELETE) and operations
+	// marked with TxIdempotent.
+	TxRetries = "tx-retries"
+	// TxIdempotent (bool) marks an operation with a non-idempotent method as safe to retry
+	TxIdempotent = "tx-idempotent"
+)
+
+// SetupTxMiddlewares runs every huma operation (except NoTx ones) in a transaction. The response is buffered
+// and the transaction is committed before the response is written, so that commit failures are reported to
+// the client. Flushing the response (e.g. for streaming) commits the transaction early, so streaming handlers
+// must not use the transaction afterwards.
 func SetupTxMiddlewares(ginEngine *gin.Engine, humaApi huma.API) {
+	initTxErrorRecorder()
+
 	ginEngine.Use(func(c *gin.Context) {
 		didPanic := true
 		defer func() {
@@ -26,26 +56,15 @@ func SetupTxMiddlewares(ginEngine *gin.Engine, humaApi huma.API) {
 				panic("not a sql.Tx")
 			}
 
-			if didPanic {
-				slog.ErrorContext(c, "rolling back due to panic")
-				_ = tx.Rollback()
-				return
-			}
-
-			statusI, ok := c.Get("status")
-			if !ok {
-				slog.ErrorContext(c, "missing status in context, rolling back")
-				_ = tx.Rollback()
-				return
-			}
-			status, ok := statusI.(int)
-			if !ok {
-				panic("status is not an int")
-			}
-			if status >= 200 && status < 300 {
-				_ = tx.Commit()
-			} else {
-				_ = tx.Rollback()
+			// the huma middleware commits or rolls back, this only catches panics
+			err := tx.Rollback()
+			if err == nil {
+				if didPanic {
+					slog.ErrorContext(c, "rolled back due to panic")
+				}
+				if hooks, ok := c.Get("tx-hooks"); ok {
+					hooks.(*querier.TxHooks).RunRollbackHooks(c)
+				}
 			}
 		}()
 
@@ -61,18 +80,266 @@ func SetupTxMiddlewares(ginEngine *gin.Engine, humaApi huma.API) {
 
 		ginCtx := humagin.Unwrap(ctx)
 
-		db := querier.GetDB(ctx.Context())
+		txOpts, err := txOptionsFromMetadata(ctx.Operation().Metadata)
+		if err != nil {
+			huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "invalid transaction options", err)
+			return
+		}
+		retries, err := txRetriesFromMetadata(ctx)
+		if err != nil {
+			huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "invalid transaction options", err)
+			return
+		}
+
+		// the request body must be re-readable for retries
+		var body []byte
+		if retries > 0 && ginCtx.Request.Body != nil {
+			body, err = io.ReadAll(ginCtx.Request.Body)
+			if err != nil {
+				huma.WriteErr(humaApi, ctx, http.StatusBadRequest, "failed to read request body", err)
+				return
+			}
+		}
+
+		for attempt := 0; ; attempt++ {
+			if body != nil {
+				ginCtx.Request.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			retry := runTx(humaApi, ctx, next, txOpts, attempt < retries)
+			if !retry {
+				return
+			}
+			slog.InfoContext(ctx.Context(), "retrying transaction after serialization failure", slog.Int("attempt", attempt+1))
+		}
+	})
+}
+
+// runTx runs next in a transaction and returns true if it failed with a serialization failure and canRetry
+// is set. In that case, nothing was written to the client.
+func runTx(humaApi huma.API, ctx huma.Context, next func(huma.Context), txOpts querier.TxOptions, canRetry bool) bool {
+	ginCtx := humagin.Unwrap(ctx)
+	db := querier.GetDB(ctx.Context())
+
+	tx, err := querier.BeginTx(ctx.Context(), db, txOpts)
+	if err != nil {
+		huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "failed to begin transaction", err)
+		return false
+	}
+	hooks := querier.NewTxHooks()
+	ginCtx.Set("tx", tx)
+	ginCtx.Set("tx-hooks", hooks)
+
+	w := &txResponseWriter{
+		humaApi: humaApi,
+		ctx:     ctx,
+		tx:      tx,
+		hooks:   hooks,
+		header:  ginCtx.Writer.Header().Clone(),
+	}
+	txCtx := huma.WithValue(&txContext{humaContext: ctx, w: w}, "tx", tx)
+	txCtx = huma.WithValue(txCtx, "tx-hooks", hooks)
+	txCtx = huma.WithValue(txCtx, txResponseWriterKey{}, w)
+
+	next(txCtx)
+
+	if w.finished {
+		// flushed early, already committed
+		return false
+	}
+	err = w.finish()
+	if err != nil {
+		if canRetry && querier.IsSqlSerializationError(err) {
+			w.resetHeader()
+			return true
+		}
+		slog.ErrorContext(ctx.Context(), "failed to commit transaction", slog.Any("error", err))
+		w.resetHeader()
+		huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "failed to commit transaction", err)
+		return false
+	}
+	if canRetry && w.serializationFailure && !isSuccessStatus(ctx.Status()) {
+		w.resetHeader()
+		return true
+	}
+	w.writeBuffered()
+	return false
+}
+
+func isSuccessStatus(status int) bool {
+	return status >= 200 && status < 300
+}
+
+type txResponseWriterKey struct{}
+
+type humaContext = huma.Context
+
+// txContext replaces the body writer with the buffering txResponseWriter
+type txContext struct {
+	humaContext
+	w *txResponseWriter
+}
+
+func (c *txContext) Unwrap() huma.Context {
+	return c.humaContext
+}
+
+func (c *txContext) BodyWriter() io.Writer {
+	return c.w
+}
+
+// txResponseWriter buffers the response body until the transaction is finished
+type txResponseWriter struct {
+	humaApi huma.API
+	ctx     huma.Context
+	tx      *sqlx.Tx
+	hooks   *querier.TxHooks
+	// header is the response header before the operation ran, restored when the buffered response is dropped
+	header http.Header
+
+	buf      bytes.Buffer
+	finished bool
+	// failed is set when the transaction failed on flush and an error response was written instead
+	failed bool
+	// serializationFailure is set when the operation failed with a serialization failure
+	serializationFailure bool
+}
+
+// finish commits the transaction if the status is 2xx, otherwise it rolls back. The commit/rollback hooks are
+// run afterwards.
+func (w *txResponseWriter) finish() error {
+	w.finished = true
+	if isSuccessStatus(w.ctx.Status()) {
+		err := w.tx.Commit()
+		if err != nil {
+			w.hooks.RunRollbackHooks(w.ctx.Context())
+			return err
+		}
+		w.hooks.RunCommitHooks(w.ctx.Context())
+		return nil
+	}
+	err := w.tx.Rollback()
+	if err != nil && !errors.Is(err, sql.ErrTxDone) {
+		slog.ErrorContext(w.ctx.Context(), "failed to roll back transaction", slog.Any("error", err))
+	}
+	w.hooks.RunRollbackHooks(w.ctx.Context())
+	return nil
+}
+
+func (w *txResponseWriter) resetHeader() {
+	h := humagin.Unwrap(w.ctx).Writer.Header()
+	clear(h)
+	for k, v := range w.header {
+		h[k] = v
+	}
+}
+
+func (w *txResponseWriter) writeBuffered() {
+	if w.buf.Len() == 0 {
+		return
+	}
+	_, err := w.ctx.BodyWriter().Write(w.buf.Bytes())
+	if err != nil {
+		slog.ErrorContext(w.ctx.Context(), "failed to write response", slog.Any("error", err))
+	}
+	w.buf.Reset()
+}
 
-		tx, err := db.Beginx()
+func (w *txResponseWriter) Write(p []byte) (int, error) {
+	if w.failed {
+		return 0, fmt.Errorf("transaction failed")
+	}
+	if w.finished {
+		return w.ctx.BodyWriter().Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+// Flush commits the transaction and writes the buffered response, switching to unbuffered writes
+func (w *txResponseWriter) Flush() {
+	if w.failed {
+		return
+	}
+	if !w.finished {
+		err := w.finish()
 		if err != nil {
-			huma.WriteErr(humaApi, ctx, http.StatusInternalServerError, "failed to begin transaction", err)
+			slog.ErrorContext(w.ctx.Context(), "failed to commit transaction", slog.Any("error", err))
+			w.failed = true
+			w.resetHeader()
+			huma.WriteErr(w.humaApi, w.ctx, http.StatusInternalServerError, "failed to commit transaction", err)
 			return
 		}
-		ginCtx.Set("tx", tx)
-		ctx = huma.WithValue(ctx, "tx", tx)
+		w.writeBuffered()
+	}
+	if f, ok := w.ctx.BodyWriter().(http.Flusher); ok {
+		f.Flush()
+	}
+}
 
-		next(ctx)
+var initTxErrorRecorderOnce sync.Once
 
-		ginCtx.Set("status", ctx.Status())
+// initTxErrorRecorder records serialization failures returned by operations, which are otherwise only visible
+// as 500 responses
+func initTxErrorRecorder() {
+	initTxErrorRecorderOnce.Do(func() {
+		orig := huma.NewErrorWithContext
+		huma.NewErrorWithContext = func(ctx huma.Context, status int, msg string, errs ...error) huma.StatusError {
+			if ctx != nil {
+				if w, ok := ctx.Context().Value(txResponseWriterKey{}).(*txResponseWriter); ok {
+					for _, err := range errs {
+						if querier.IsSqlSerializationError(err) {
+							w.serializationFailure = true
+						}
+					}
+				}
+			}
+			return orig(ctx, status, msg, errs...)
+		}
 	})
 }
+
+func txRetriesFromMetadata(ctx huma.Context) (int, error) {
+	v, ok := ctx.Operation().Metadata[TxRetries]
+	if !ok {
+		return 0, nil
+	}
+	retries, ok := v.(int)
+	if !ok {
+		return 0, fmt.Errorf("invalid %s metadata type %T", TxRetries, v)
+	}
+	switch ctx.Method() {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return retries, nil
+	}
+	if HasMetadataTrue(ctx, TxIdempotent) {
+		return retries, nil
+	}
+	return 0, nil
+}
+
+func txOptionsFromMetadata(m map[string]any) (querier.TxOptions, error) {
+	var ret querier.TxOptions
+	var err error
+
+	ret.ReadOnly = HasMetadataTrue2(m, TxReadOnly)
+	switch v := m[TxIsolationLevel].(type) {
+	case nil:
+	case sql.IsolationLevel:
+		ret.Isolation = v
+	case string:
+		ret.Isolation, err = querier.ParseIsolationLevel(v)
+		if err != nil {
+			return ret, err
+		}
+	default:
+		return ret, fmt.Errorf("invalid %s metadata type %T", TxIsolationLevel, v)
+	}
+	ret.StatementTimeout, err = getMetadataDuration(m, TxStatementTimeout)
+	if err != nil {
+		return ret, err
+	}
+	ret.LockTimeout, err = getMetadataDuration(m, TxLockTimeout)
+	if err != nil {
+		return ret, err
+	}
+	return ret, nil
+}